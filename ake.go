@@ -33,6 +33,12 @@ type ake struct {
 	keys  keyManagementContext
 
 	lastStateChange time.Time
+	// waitingSince is when we started waiting for the peer in the current state. It is kept apart from
+	// lastStateChange, since sending a DH-Commit must not make repeated query messages be ignored.
+	waitingSince time.Time
+
+	// previousTheirKey is the key of the peer in the encrypted conversation that was active when this AKE started
+	previousTheirKey PublicKey
 }
 
 func (c *Conversation) ensureAKE() {
@@ -101,6 +107,7 @@ func (c *Conversation) calcXb(key *akeKeys, mb []byte) ([]byte, error) {
 // Bob ---- DH Commit -----------> Alice
 func (c *Conversation) dhCommitMessage() ([]byte, error) {
 	c.initAKE()
+	c.rememberPeerIdentity()
 	c.ake.keys.ourKeyID = 0
 
 	// A random value x of at least 320 bits (40 byte)
@@ -209,10 +216,26 @@ func (c *Conversation) processDHCommit(msg []byte) error {
 
 	c.ake.encryptedGx = dhCommitMsg.encryptedGx
 	c.ake.xhashedGx = dhCommitMsg.yhashedGx
+	c.rememberPeerIdentity()
 
 	return err
 }
 
+// rememberPeerIdentity records who the peer is when an AKE starts during an encrypted conversation,
+// so that we can tell if the peer authenticates with a different key when the AKE finishes
+func (c *Conversation) rememberPeerIdentity() {
+	c.ake.previousTheirKey = nil
+	if c.msgState == encrypted {
+		c.ake.previousTheirKey = c.theirKey
+	}
+}
+
+// peerIdentityChanged returns true if this AKE was started during an encrypted conversation and the peer
+// authenticated with a different key than the one used in that conversation
+func (c *Conversation) peerIdentityChanged() bool {
+	return c.ake.previousTheirKey != nil && !c.ake.previousTheirKey.Equal(c.theirKey)
+}
+
 // processDHKey = bob = x
 // Alice -- DH Key --------------> Bob
 func (c *Conversation) processDHKey(msg []byte) (isSame bool, err error) {
@@ -0,0 +1,91 @@
+package otr3
+
+import "time"
+
+// AKETimeouts decides how long the AKE waits for the peer in each state before it is abandoned.
+// A timeout of zero means waiting forever in that state, which is the default.
+//
+// If ResendQuery is set, the query message is sent again when the AKE times out while the conversation
+// is not encrypted. As long as no new AKE is started, it will then be sent again after QueryBackoff,
+// with the wait doubling every time up to MaxQueryBackoff. If QueryBackoff is zero, it starts at one minute,
+// since the peer will ignore query messages repeated faster than that anyway.
+type AKETimeouts struct {
+	AwaitingDHKey     time.Duration
+	AwaitingRevealSig time.Duration
+	AwaitingSig       time.Duration
+
+	ResendQuery     bool
+	QueryBackoff    time.Duration
+	MaxQueryBackoff time.Duration
+}
+
+type akeRetryContext struct {
+	next    time.Time
+	backoff time.Duration
+}
+
+// SetAKETimeouts sets the timeouts for the AKE
+func (c *Conversation) SetAKETimeouts(t AKETimeouts) {
+	c.akeTimeouts = t
+}
+
+func (t AKETimeouts) forState(s authState) time.Duration {
+	switch s.(type) {
+	case authStateAwaitingDHKey:
+		return t.AwaitingDHKey
+	case authStateAwaitingRevealSig:
+		return t.AwaitingRevealSig
+	case authStateAwaitingSig:
+		return t.AwaitingSig
+	}
+	return 0
+}
+
+func (c *Conversation) akeHasTimedOut(now time.Time) bool {
+	if c.ake == nil || c.ake.state == nil {
+		return false
+	}
+	timeout := c.akeTimeouts.forState(c.ake.state)
+	return timeout > 0 && now.Sub(c.ake.waitingSince) > timeout
+}
+
+// CheckAKETimeout should be called regularly by the host, for example from a timer.
+// If the AKE has waited for the peer for longer than the timeout for its current state, the AKE is reset and
+// the message event handler is notified with MessageEventSetupTimeout. If the query message should be resent,
+// it will be among the returned messages, both right after the timeout and every time the backoff has passed.
+// The host passes the current time from its own clock.
+func (c *Conversation) CheckAKETimeout(now time.Time) ([]ValidMessage, error) {
+	if c.akeHasTimedOut(now) {
+		state := c.ake.state.identityString()
+		c.ake.wipe(true)
+		c.ake = nil
+		c.messageEventWithError(MessageEventSetupTimeout, newOtrErrorf("AKE timed out in state %s", state))
+
+		if !c.akeTimeouts.ResendQuery || c.IsEncrypted() {
+			return nil, nil
+		}
+		c.akeRetry = &akeRetryContext{backoff: c.akeTimeouts.QueryBackoff}
+		if c.akeRetry.backoff == 0 {
+			c.akeRetry.backoff = timeoutLength
+		}
+		return c.resendQuery(now), nil
+	}
+
+	if c.akeRetry == nil || c.IsEncrypted() || (c.ake != nil && c.ake.state != authStateNone{}) {
+		return nil, nil
+	}
+	if now.Before(c.akeRetry.next) {
+		return nil, nil
+	}
+	return c.resendQuery(now), nil
+}
+
+func (c *Conversation) resendQuery(now time.Time) []ValidMessage {
+	r := c.akeRetry
+	r.next = now.Add(r.backoff)
+	r.backoff *= 2
+	if max := c.akeTimeouts.MaxQueryBackoff; max > 0 && r.backoff > max {
+		r.backoff = max
+	}
+	return []ValidMessage{c.QueryMessage()}
+}
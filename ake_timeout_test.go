@@ -0,0 +1,136 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+func akeTimeoutFixture() (alice, bob *Conversation, events *[]MessageEvent) {
+	alice = &Conversation{Rand: rand.Reader}
+	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
+	alice.Policies = policies(allowV3)
+
+	bob = &Conversation{Rand: rand.Reader}
+	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
+	bob.Policies = policies(allowV3)
+
+	var es []MessageEvent
+	alice.SetMessageEventHandler(dynamicMessageEventHandler{func(e MessageEvent, _ []byte, _ error, _ ...interface{}) {
+		es = append(es, e)
+	}})
+	return alice, bob, &es
+}
+
+func Test_CheckAKETimeout_doesNothingWithoutTimeouts(t *testing.T) {
+	alice, bob, events := akeTimeoutFixture()
+	_, _, err := alice.Receive(bob.QueryMessage())
+	assertNil(t, err)
+
+	msgs, err := alice.CheckAKETimeout(time.Now().Add(time.Hour))
+	assertNil(t, err)
+	assertNil(t, msgs)
+	assertEquals(t, alice.ake.state, authStateAwaitingDHKey{})
+	assertEquals(t, len(*events), 0)
+}
+
+func Test_CheckAKETimeout_resetsTheAKEWhenAwaitingDHKeyForTooLong(t *testing.T) {
+	alice, bob, events := akeTimeoutFixture()
+	alice.SetAKETimeouts(AKETimeouts{AwaitingDHKey: time.Minute})
+	_, _, err := alice.Receive(bob.QueryMessage())
+	assertNil(t, err)
+
+	msgs, err := alice.CheckAKETimeout(time.Now())
+	assertNil(t, err)
+	assertNil(t, msgs)
+	assertEquals(t, alice.ake.state, authStateAwaitingDHKey{})
+
+	msgs, err = alice.CheckAKETimeout(time.Now().Add(2 * time.Minute))
+	assertNil(t, err)
+	assertNil(t, msgs)
+	assertNil(t, alice.ake)
+	assertDeepEquals(t, *events, []MessageEvent{MessageEventSetupTimeout})
+}
+
+func Test_CheckAKETimeout_usesTheTimeoutForTheCurrentState(t *testing.T) {
+	alice, bob, events := akeTimeoutFixture()
+	bob.SetMessageEventHandler(alice.messageEventHandler)
+	bob.SetAKETimeouts(AKETimeouts{AwaitingRevealSig: time.Minute})
+	alice.SetAKETimeouts(AKETimeouts{AwaitingSig: time.Minute})
+
+	_, toSend, _ := alice.Receive(bob.QueryMessage())
+	_, toSend, _ = bob.Receive(toSend[0])
+	assertEquals(t, bob.ake.state, authStateAwaitingRevealSig{})
+	_, _, _ = alice.Receive(toSend[0])
+	assertEquals(t, alice.ake.state.identity(), authStateAwaitingSig{}.identity())
+
+	later := time.Now().Add(2 * time.Minute)
+	_, _ = alice.CheckAKETimeout(later)
+	_, _ = bob.CheckAKETimeout(later)
+	assertNil(t, alice.ake)
+	assertNil(t, bob.ake)
+	assertDeepEquals(t, *events, []MessageEvent{MessageEventSetupTimeout, MessageEventSetupTimeout})
+}
+
+func Test_CheckAKETimeout_resendsTheQueryMessageWithExponentialBackoff(t *testing.T) {
+	alice, bob, _ := akeTimeoutFixture()
+	alice.SetAKETimeouts(AKETimeouts{AwaitingDHKey: time.Minute, ResendQuery: true, QueryBackoff: time.Minute, MaxQueryBackoff: 3 * time.Minute})
+	_, _, _ = alice.Receive(bob.QueryMessage())
+
+	now := time.Now().Add(2 * time.Minute)
+	msgs, err := alice.CheckAKETimeout(now)
+	assertNil(t, err)
+	assertDeepEquals(t, msgs, []ValidMessage{alice.QueryMessage()})
+	assertEquals(t, alice.akeRetry.backoff, 2*time.Minute)
+
+	msgs, _ = alice.CheckAKETimeout(now.Add(59 * time.Second))
+	assertNil(t, msgs)
+
+	now = now.Add(time.Minute)
+	msgs, _ = alice.CheckAKETimeout(now)
+	assertDeepEquals(t, msgs, []ValidMessage{alice.QueryMessage()})
+	assertEquals(t, alice.akeRetry.backoff, 3*time.Minute)
+
+	now = now.Add(2 * time.Minute)
+	_, _ = alice.CheckAKETimeout(now)
+	assertEquals(t, alice.akeRetry.backoff, 3*time.Minute)
+}
+
+func Test_CheckAKETimeout_usesAOneMinuteBackoffByDefault(t *testing.T) {
+	alice, bob, _ := akeTimeoutFixture()
+	alice.SetAKETimeouts(AKETimeouts{AwaitingDHKey: time.Minute, ResendQuery: true})
+	_, _, _ = alice.Receive(bob.QueryMessage())
+
+	now := time.Now().Add(2 * time.Minute)
+	_, _ = alice.CheckAKETimeout(now)
+	assertEquals(t, alice.akeRetry.backoff, 2*time.Minute)
+	assertEquals(t, alice.akeRetry.next, now.Add(time.Minute))
+}
+
+func Test_CheckAKETimeout_stopsResendingOnceTheAKEFinishes(t *testing.T) {
+	alice, bob, _ := akeTimeoutFixture()
+	alice.SetAKETimeouts(AKETimeouts{AwaitingDHKey: time.Minute, ResendQuery: true})
+	_, _, _ = alice.Receive(bob.QueryMessage())
+	_, _ = alice.CheckAKETimeout(time.Now().Add(2 * time.Minute))
+
+	completeAKE(t, alice, bob)
+	assertNil(t, alice.akeRetry)
+
+	msgs, _ := alice.CheckAKETimeout(time.Now().Add(time.Hour))
+	assertNil(t, msgs)
+}
+
+func Test_CheckAKETimeout_doesNotResendTheQueryWhenStillEncrypted(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	alice.SetAKETimeouts(AKETimeouts{AwaitingDHKey: time.Minute, ResendQuery: true})
+	allowImmediateNewAKE(alice)
+	_, _, err := alice.Receive(bob.QueryMessage())
+	assertNil(t, err)
+	assertEquals(t, alice.ake.state, authStateAwaitingDHKey{})
+
+	msgs, err := alice.CheckAKETimeout(time.Now().Add(2 * time.Minute))
+	assertNil(t, err)
+	assertNil(t, msgs)
+	assertNil(t, alice.ake)
+	assertEquals(t, alice.IsEncrypted(), true)
+}
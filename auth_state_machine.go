@@ -10,15 +10,19 @@ func (c *Conversation) generateNewDHKeyPair() error {
 }
 
 func (c *Conversation) akeHasFinished() error {
+	identityChanged := c.peerIdentityChanged()
 	c.keys.wipe()
 	c.keys = c.ake.keys
 	c.ake.wipe(false)
+	c.akeRetry = nil
 
 	previousMsgState := c.msgState
 	c.lastMessageStateChange = time.Now()
 	c.msgState = encrypted
+	defer c.signalSecurityEventIf(c.lookupVerification(), PeerVerified)
 	defer c.signalSecurityEventIf(previousMsgState != encrypted, GoneSecure)
 	defer c.signalSecurityEventIf(previousMsgState == encrypted, StillSecure)
+	defer c.signalSecurityEventIf(identityChanged, PeerKeyChanged)
 
 	if c.ourCurrentKey.PublicKey().IsSame(c.theirKey) {
 		c.messageEvent(MessageEventMessageReflected)
@@ -28,6 +32,7 @@ func (c *Conversation) akeHasFinished() error {
 }
 
 func (c *Conversation) processAKE(msgType byte, msg []byte) (toSend []messageWithHeader, err error) {
+	c.waitForSMP()
 	c.ensureAKE()
 
 	var toSendSingle messageWithHeader
@@ -49,6 +54,7 @@ func (c *Conversation) processAKE(msgType byte, msg []byte) (toSend []messageWit
 	}
 
 	c.ake.lastStateChange = time.Now()
+	c.ake.waitingSince = c.ake.lastStateChange
 
 	messages := append([]messageWithHeader{toSendSingle}, toSendExtra...)
 	toSend = compactMessagesWithHeader(messages...)
@@ -1,6 +1,7 @@
 package otr3
 
 import (
+	"encoding/hex"
 	"math/big"
 	"testing"
 )
@@ -648,6 +649,47 @@ func Test_akeHasFinished_willSignalThatWeHaveGoneSecureIfWeHaveRefreshed(t *test
 	}, StillSecure)
 }
 
+func Test_akeHasFinished_willSignalThatThePeerKeyChangedIfTheyUsedAnotherKeyInANewAKE(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.ourCurrentKey = bobPrivateKey
+	c.msgState = encrypted
+	c.ake.previousTheirKey = alicePrivateKey.PublicKey()
+	c.theirKey = bobPrivateKey.PublicKey()
+
+	var events []SecurityEvent
+	c.securityEventHandler = dynamicSecurityEventHandler{func(event SecurityEvent) {
+		events = append(events, event)
+	}}
+	_ = c.akeHasFinished()
+
+	assertDeepEquals(t, events, []SecurityEvent{PeerKeyChanged, StillSecure})
+}
+
+func Test_akeHasFinished_willNotSignalThatThePeerKeyChangedForAnEqualKey(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.ourCurrentKey = bobPrivateKey
+	c.msgState = encrypted
+	c.ake.previousTheirKey = alicePrivateKey.PublicKey()
+	c.theirKey = parseIntoPrivateKey(hex.EncodeToString(alicePrivateKey.Serialize())).PublicKey()
+
+	c.expectSecurityEvent(t, func() {
+		_ = c.akeHasFinished()
+	}, StillSecure)
+}
+
+func Test_processDHCommit_remembersThePeerKeyOfAnEncryptedConversation(t *testing.T) {
+	c := aliceContextAtAwaitingDHCommit()
+	c.msgState = encrypted
+	c.theirKey = bobPrivateKey.PublicKey()
+
+	_ = c.processDHCommit(fixtureDHCommitMsgBody())
+	assertEquals(t, c.ake.previousTheirKey, c.theirKey)
+
+	c.msgState = plainText
+	_ = c.processDHCommit(fixtureDHCommitMsgBody())
+	assertNil(t, c.ake.previousTheirKey)
+}
+
 func Test_akeHasFinished_wipesAKEKeys(t *testing.T) {
 	c := &Conversation{}
 	c.ourCurrentKey = bobPrivateKey
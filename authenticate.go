@@ -4,11 +4,21 @@ package otr3
 // The authentication uses an optional question message and a shared secret. The authentication will proceed
 // until the event handler reports that SMP is complete, that a secret is needed or that SMP has failed.
 func (c *Conversation) StartAuthenticate(question string, mutualSecret []byte) ([]ValidMessage, error) {
+	if !c.IsEncrypted() {
+		return nil, errCantAuthenticateWithoutEncryption
+	}
+
+	c.waitForSMP()
 	c.smp.ensureSMP()
 
-	tlvs, err := c.smp.state.startAuthenticate(c, question, mutualSecret)
+	mutualSecret = makeCopy(mutualSecret)
+	tlvs, err := c.runSMPStep(messageFlagIgnoreUnreadable, func(c *Conversation) ([]tlv, error) {
+		tlvs, err := c.smp.state.startAuthenticate(c, question, mutualSecret)
+		c.smpStateChanged()
+		return tlvs, err
+	})
 
-	if err != nil {
+	if err != nil || len(tlvs) == 0 {
 		return nil, err
 	}
 
@@ -19,18 +29,30 @@ func (c *Conversation) StartAuthenticate(question string, mutualSecret []byte) (
 // ProvideAuthenticationSecret should be called when the peer has started an authentication request, and the UI has been notified that a secret is needed
 // It is only valid to call this function if the current SMP state is waiting for a secret to be provided. The return is the potential messages to send.
 func (c *Conversation) ProvideAuthenticationSecret(mutualSecret []byte) ([]ValidMessage, error) {
-	t, err := c.continueSMP(mutualSecret)
-	if err != nil {
+	c.waitForSMP()
+	c.smp.ensureSMP()
+
+	mutualSecret = makeCopy(mutualSecret)
+	tlvs, err := c.runSMPStep(messageFlagIgnoreUnreadable, func(c *Conversation) ([]tlv, error) {
+		t, err := c.continueSMP(mutualSecret)
+		if err != nil {
+			return nil, err
+		}
+		return []tlv{*t}, nil
+	})
+
+	if err != nil || len(tlvs) == 0 {
 		return nil, err
 	}
 
-	msgs, _, err := c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, []tlv{*t})
+	msgs, _, err := c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, tlvs)
 	return msgs, err
 }
 
 // AbortAuthentication should be called when the user wants to abort authentication with a peer.
 // It will return an SMP abort message to send.
 func (c *Conversation) AbortAuthentication() ([]ValidMessage, error) {
+	c.waitForSMP()
 	t := c.restartSMP()
 
 	msgs, _, err := c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, []tlv{t})
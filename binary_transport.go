@@ -0,0 +1,173 @@
+package otr3
+
+import "bytes"
+
+// A binary frame starts with a NUL byte, which can't start a text OTR message, followed by the frame kind.
+// A message frame carries the raw OTR message, with its usual message header. A fragment frame carries
+// the fragment index and count as shorts, preceded by the sender and receiver instance tags for version 3.
+var binaryFrameMarker = []byte{0x00, 'O'}
+
+const (
+	binaryFrameMessage    byte = 0x01
+	binaryFrameFragmentV2 byte = 0x02
+	binaryFrameFragmentV3 byte = 0x03
+
+	binaryFrameHeaderLen    = 3
+	binaryFrameMaxFragments = 0xFFFF
+)
+
+// SetBinaryTransport makes the conversation send OTR messages as binary frames instead of base64 text
+// inside the ?OTR: envelope, which makes them about a quarter smaller. Fragmentation is done by byte length
+// in the same way, using a compact binary header. Only use this when the transport can carry arbitrary bytes,
+// and both peers have enabled it, since binary frames are received as plain text otherwise.
+// Query messages, whitespace tags and error messages are still sent as text.
+func (c *Conversation) SetBinaryTransport(v bool) {
+	c.binaryTransport = v
+}
+
+func isBinaryFrame(msg []byte) bool {
+	return len(msg) >= binaryFrameHeaderLen && bytes.HasPrefix(msg, binaryFrameMarker)
+}
+
+func binaryFrameHeader(kind byte) []byte {
+	return append([]byte{binaryFrameMarker[0], binaryFrameMarker[1]}, kind)
+}
+
+func encodeBinary(msg messageWithHeader) encodedMessage {
+	return append(binaryFrameHeader(binaryFrameMessage), msg...)
+}
+
+func (c *Conversation) binaryFragmentPrefix(n, total int) []byte {
+	var prefix []byte
+	if c.version.protocolVersion() == 3 {
+		prefix = binaryFrameHeader(binaryFrameFragmentV3)
+		prefix = AppendWord(prefix, c.ourInstanceTag)
+		prefix = AppendWord(prefix, c.theirInstanceTag)
+	} else {
+		prefix = binaryFrameHeader(binaryFrameFragmentV2)
+	}
+	prefix = AppendShort(prefix, uint16(n+1))
+	return AppendShort(prefix, uint16(total))
+}
+
+func (c *Conversation) fragmentBinary(data encodedMessage, fraglen uint16) []ValidMessage {
+	msg := data[binaryFrameHeaderLen:]
+	headerLen := len(c.binaryFragmentPrefix(0, 1))
+	realFraglen := int(fraglen) - headerLen
+
+	if len(data) <= int(fraglen) || fraglen == 0 || realFraglen <= 0 {
+		return []ValidMessage{ValidMessage(data)}
+	}
+
+	numFragments := (len(msg) + realFraglen - 1) / realFraglen
+	if numFragments > binaryFrameMaxFragments {
+		return []ValidMessage{ValidMessage(data)}
+	}
+
+	ret := make([]ValidMessage, numFragments)
+	for i := 0; i < numFragments; i++ {
+		end := (i + 1) * realFraglen
+		if end > len(msg) {
+			end = len(msg)
+		}
+		ret[i] = append(c.binaryFragmentPrefix(i, numFragments), msg[i*realFraglen:end]...)
+	}
+	return ret
+}
+
+func (c *Conversation) receiveBinary(message []byte, forgetFragments bool) (plain MessagePlaintext, toSend []ValidMessage, err error) {
+	var messagesToSend []messageWithHeader
+	shouldForgetFragment := true
+	switch message[binaryFrameHeaderLen-1] {
+	case binaryFrameMessage:
+		plain, messagesToSend, err = c.receiveDecoded(makeCopy(message[binaryFrameHeaderLen:]))
+	case binaryFrameFragmentV2, binaryFrameFragmentV3:
+		shouldForgetFragment = false
+		c.fragmentationContext, err = c.receiveBinaryFragment(c.fragmentationContext, message)
+		if fragmentsFinished(c.fragmentationContext) {
+			return c.withInjectionsPlain(c.receiveUnit(ValidMessage(encodeBinary(c.fragmentationContext.frag)), false))
+		}
+	default:
+		c.messageEvent(MessageEventReceivedMessageUnrecognized)
+	}
+
+	if shouldForgetFragment && forgetFragments {
+		c.fragmentationContext = forgetFragment()
+	}
+
+	return c.withInjectionsPlain(c.toSendEncoded(plain, messagesToSend, err))
+}
+
+func (c *Conversation) parseBinaryFragmentPrefix(data []byte) (rest []byte, ignore bool, ok bool) {
+	kind := data[binaryFrameHeaderLen-1]
+	version := uint16(2)
+	if kind == binaryFrameFragmentV3 {
+		version = 3
+	}
+
+	if err := c.commitToVersionFrom(1 << version); err != nil {
+		return data, true, false
+	}
+
+	if c.version.protocolVersion() != version {
+		return data, false, false
+	}
+
+	rest = data[binaryFrameHeaderLen:]
+	if version == 2 {
+		return rest, false, true
+	}
+
+	rest, senderInstanceTag, ok1 := ExtractWord(rest)
+	rest, receiverInstanceTag, ok2 := ExtractWord(rest)
+	if !ok1 || !ok2 {
+		return data, false, false
+	}
+
+	if err := (otrV3{}).verifyInstanceTags(c, senderInstanceTag, receiverInstanceTag); err != nil {
+		switch err {
+		case errInvalidOTRMessage:
+			return data, false, false
+		case errReceivedMessageForOtherInstance:
+			return data, true, true
+		}
+	}
+
+	return rest, false, true
+}
+
+func (c *Conversation) receiveBinaryFragment(beforeCtx fragmentationContext, data []byte) (fragmentationContext, error) {
+	fragBody, ignore, ok1 := c.parseBinaryFragmentPrefix(data)
+	fragBody, ix, ok2 := ExtractShort(fragBody)
+	resultData, l, ok3 := ExtractShort(fragBody)
+
+	if ignore {
+		c.messageEvent(MessageEventReceivedMessageForOtherInstance)
+		return beforeCtx, nil
+	}
+
+	if !ok1 || !ok2 || !ok3 {
+		return beforeCtx, newOtrError("invalid OTR fragment")
+	}
+
+	return beforeCtx.addFragment(resultData, ix, l), nil
+}
+
+func extractBinaryInstanceTags(m []byte) (ours, theirs uint32, ok bool) {
+	switch m[binaryFrameHeaderLen-1] {
+	case binaryFrameMessage:
+		msg := m[binaryFrameHeaderLen:]
+		if len(msg) < otrv3HeaderLen {
+			return 0, 0, false
+		}
+
+		_, senderInstanceTag, _ := ExtractWord(msg[messageHeaderPrefix:])
+		_, receiverInstanceTag, _ := ExtractWord(msg[messageHeaderPrefix+4:])
+		return receiverInstanceTag, senderInstanceTag, true
+	case binaryFrameFragmentV3:
+		rest, senderInstanceTag, ok1 := ExtractWord(m[binaryFrameHeaderLen:])
+		_, receiverInstanceTag, ok2 := ExtractWord(rest)
+		return receiverInstanceTag, senderInstanceTag, ok1 && ok2
+	}
+	return 0, 0, false
+}
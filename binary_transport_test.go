@@ -0,0 +1,124 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+func binaryConversations(t *testing.T, fragmentSize uint16) (alice, bob *Conversation) {
+	alice = &Conversation{Rand: rand.Reader}
+	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
+	alice.Policies = policies(allowV3)
+	alice.SetBinaryTransport(true)
+	alice.SetFragmentSize(fragmentSize)
+
+	bob = &Conversation{Rand: rand.Reader}
+	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
+	bob.Policies = policies(allowV3)
+	bob.SetBinaryTransport(true)
+	bob.SetFragmentSize(fragmentSize)
+
+	toSend := []ValidMessage{alice.QueryMessage()}
+	receivers := []*Conversation{bob, alice}
+	for i := 0; len(toSend) > 0; i++ {
+		toSend = deliverAll(t, receivers[i%2], toSend)
+	}
+	return
+}
+
+func Test_BinaryTransport_completesTheAKEAndExchangesMessages(t *testing.T) {
+	alice, bob := binaryConversations(t, 0)
+	assertEquals(t, alice.IsEncrypted(), true)
+	assertEquals(t, bob.IsEncrypted(), true)
+
+	msgs, err := alice.Send(ValidMessage("hello"))
+	assertNil(t, err)
+	assertEquals(t, len(msgs), 1)
+	assertEquals(t, isBinaryFrame(msgs[0]), true)
+	assertEquals(t, string(receiveAll(t, bob, msgs...)), "hello")
+
+	msgs, _ = bob.Send(ValidMessage("hi there"))
+	assertEquals(t, string(receiveAll(t, alice, msgs...)), "hi there")
+}
+
+func Test_BinaryTransport_fragmentsByByteLength(t *testing.T) {
+	alice, bob := binaryConversations(t, 100)
+	assertEquals(t, alice.IsEncrypted(), true)
+
+	message := strings.Repeat("hello world ", 50)
+	msgs, err := alice.Send(ValidMessage(message))
+	assertNil(t, err)
+	assertEquals(t, len(msgs) > 1, true)
+	for _, m := range msgs {
+		assertEquals(t, len(m) <= 100, true)
+		assertEquals(t, m[2], binaryFrameFragmentV3)
+	}
+
+	assertEquals(t, string(receiveAll(t, bob, msgs...)), message)
+}
+
+func Test_BinaryTransport_producesSmallerMessagesThanText(t *testing.T) {
+	alice, _ := conversationsAfterAKE(t)
+	message := ValidMessage(strings.Repeat("a", 1000))
+
+	text, _ := alice.EstimateWireSize(message)
+	alice.SetBinaryTransport(true)
+	binary, _ := alice.EstimateWireSize(message)
+
+	assertEquals(t, binary.TotalSize < text.TotalSize*4/5, true)
+}
+
+func Test_BinaryTransport_ignoresFragmentsForOtherInstances(t *testing.T) {
+	alice, bob := binaryConversations(t, 100)
+	msgs, _ := alice.Send(ValidMessage(strings.Repeat("hello world ", 50)))
+
+	var events []MessageEvent
+	bob.SetMessageEventHandler(dynamicMessageEventHandler{func(e MessageEvent, _ []byte, _ error, _ ...interface{}) {
+		events = append(events, e)
+	}})
+	other := makeCopy(msgs[0])
+	copy(other[binaryFrameHeaderLen+4:], []byte{0x00, 0x00, 0x01, 0x01})
+
+	plain, toSend, err := bob.Receive(other)
+	assertNil(t, err)
+	assertNil(t, plain)
+	assertNil(t, toSend)
+	assertEquals(t, len(events) > 0, true)
+	for _, e := range events {
+		assertEquals(t, e, MessageEventReceivedMessageForOtherInstance)
+	}
+}
+
+func Test_BinaryTransport_returnsAnErrorForATruncatedFragment(t *testing.T) {
+	_, bob := binaryConversations(t, 0)
+
+	_, _, err := bob.Receive(ValidMessage{0x00, 'O', binaryFrameFragmentV3, 0x01})
+	assertEquals(t, err, newOtrError("invalid OTR fragment"))
+}
+
+func Test_BinaryTransport_treatsBinaryFramesAsPlaintextWhenNotEnabled(t *testing.T) {
+	alice, bob := binaryConversations(t, 0)
+	bob.SetBinaryTransport(false)
+
+	msgs, _ := alice.Send(ValidMessage("hello"))
+	plain, _, err := bob.Receive(msgs[0])
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext(msgs[0]))
+}
+
+func Test_ExtractInstanceTags_worksForBinaryFrames(t *testing.T) {
+	alice, bob := binaryConversations(t, 100)
+
+	msgs, _ := alice.Send(ValidMessage("hi"))
+	ours, theirs, ok := ExtractInstanceTags(msgs[0])
+	assertEquals(t, ok, true)
+	assertEquals(t, ours, bob.ourInstanceTag)
+	assertEquals(t, theirs, alice.ourInstanceTag)
+
+	msgs, _ = alice.Send(ValidMessage(strings.Repeat("hello world ", 50)))
+	ours, theirs, ok = ExtractInstanceTags(msgs[1])
+	assertEquals(t, ok, true)
+	assertEquals(t, ours, bob.ourInstanceTag)
+	assertEquals(t, theirs, alice.ourInstanceTag)
+}
@@ -0,0 +1,147 @@
+package otr3
+
+import (
+	"encoding/binary"
+	"math/big"
+	"math/bits"
+)
+
+// The multiplication and subtraction modulo q on secret values work on fixed width numbers of 64 bit limbs,
+// least significant limb first. Every operation runs the same sequence of instructions for all numbers of
+// the same width, so the time taken doesn't depend on the values, only on the width.
+
+// secretLimbs is the width in limbs of the secret values, which is the length of p
+const secretLimbs = secretExponentLength / 8
+
+type limbs []uint64
+
+// limbsFromBig returns x as a number of at least n limbs. Larger values get as many limbs as they need.
+func limbsFromBig(x *big.Int, n int) limbs {
+	if bl := (x.BitLen() + 63) / 64; bl > n {
+		n = bl
+	}
+
+	b := x.FillBytes(make([]byte, n*8))
+	defer wipeBytes(b)
+
+	res := make(limbs, n)
+	for i := range res {
+		res[i] = binary.BigEndian.Uint64(b[len(b)-8*(i+1):])
+	}
+	return res
+}
+
+func (l limbs) big() *big.Int {
+	b := make([]byte, len(l)*8)
+	defer wipeBytes(b)
+
+	for i, v := range l {
+		binary.BigEndian.PutUint64(b[len(b)-8*(i+1):], v)
+	}
+	return new(big.Int).SetBytes(b)
+}
+
+// addLimbs sets z to x + y and returns the carry. All three must have the same width.
+func addLimbs(z, x, y limbs) uint64 {
+	var carry uint64
+	for i := range z {
+		z[i], carry = bits.Add64(x[i], y[i], carry)
+	}
+	return carry
+}
+
+// subLimbs sets z to x - y and returns the borrow. All three must have the same width.
+func subLimbs(z, x, y limbs) uint64 {
+	var borrow uint64
+	for i := range z {
+		z[i], borrow = bits.Sub64(x[i], y[i], borrow)
+	}
+	return borrow
+}
+
+// selectLimbs sets z to x if choice is 1, and to y if choice is 0, without branching on choice
+func selectLimbs(choice uint64, z, x, y limbs) {
+	mask := -choice
+	for i := range z {
+		z[i] = (x[i] & mask) | (y[i] &^ mask)
+	}
+}
+
+// mulLimbs returns the full product of x and y
+func mulLimbs(x, y limbs) limbs {
+	z := make(limbs, len(x)+len(y))
+	for i := range x {
+		var carry uint64
+		for j := range y {
+			hi, lo := bits.Mul64(x[i], y[j])
+			var c uint64
+			lo, c = bits.Add64(lo, z[i+j], 0)
+			hi += c
+			lo, c = bits.Add64(lo, carry, 0)
+			hi += c
+			z[i+j] = lo
+			carry = hi
+		}
+		z[i+len(y)] = carry
+	}
+	return z
+}
+
+// reduceLimbs returns x mod m, with the width of m. It goes through x one bit at a time,
+// doubling the remainder and subtracting m whenever the remainder is not smaller than m.
+func reduceLimbs(x, m limbs) limbs {
+	n := len(m)
+	mm := make(limbs, n+1)
+	copy(mm, m)
+
+	r := make(limbs, n+1)
+	t := make(limbs, n+1)
+	defer wipeUint64(t)
+
+	for i := len(x)*64 - 1; i >= 0; i-- {
+		carry := (x[i/64] >> uint(i%64)) & 1
+		for j := range r {
+			r[j], carry = r[j]<<1|carry, r[j]>>63
+		}
+		borrow := subLimbs(t, r, mm)
+		selectLimbs(borrow, r, r, t)
+	}
+
+	return r[:n]
+}
+
+// subMulModCT calculates r - a*c mod m in constant time
+func subMulModCT(r, a, c, m *big.Int) *big.Int {
+	n := secretLimbs
+	if ml := (m.BitLen() + 63) / 64; ml > n {
+		n = ml
+	}
+	ml := limbsFromBig(m, n)
+
+	rl := limbsFromBig(r, n)
+	al := limbsFromBig(a, n)
+	cl := limbsFromBig(c, n)
+	prod := mulLimbs(al, cl)
+	defer func() {
+		wipeUint64(rl)
+		wipeUint64(al)
+		wipeUint64(cl)
+		wipeUint64(prod)
+	}()
+
+	rr := reduceLimbs(rl, ml)
+	ac := reduceLimbs(prod, ml)
+	defer wipeUint64(rr)
+	defer wipeUint64(ac)
+
+	res := make(limbs, n)
+	t := make(limbs, n)
+	defer wipeUint64(res)
+	defer wipeUint64(t)
+
+	borrow := subLimbs(res, rr, ac)
+	addLimbs(t, res, ml)
+	selectLimbs(borrow, res, t, res)
+
+	return res.big()
+}
@@ -22,6 +22,23 @@ func modExpPCT(g *constbn.Int, x secretKeyValue) *constbn.Int {
 	return modExpCT(g, x, pct)
 }
 
+// secretExponentLength is the length in bytes of the largest SMP exponent, which is the length of p
+const secretExponentLength = 192
+
+// modExpPSecret calculates g^x mod p in constant time, and should be used whenever the exponent is secret.
+// The exponent is always padded to the same length, so that the time taken doesn't depend on its size either.
+func modExpPSecret(g, x *big.Int) *big.Int {
+	l := secretExponentLength
+	if bl := (x.BitLen() + 7) / 8; bl > l {
+		l = bl
+	}
+
+	e := secretKeyValue(x.FillBytes(make([]byte, l)))
+	defer wipeBytes(e)
+
+	return modExpPCT(new(constbn.Int).SetBigInt(g), e).GetBigInt()
+}
+
 func modInverse(g, x *big.Int) *big.Int {
 	return new(big.Int).ModInverse(g, x)
 }
@@ -0,0 +1,387 @@
+package otr3
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// MessageTransport is a message oriented transport, such as a chat connection or a datagram socket, that a Conn can run over.
+// ReadMessage will be called from a separate goroutine than WriteMessage and Close.
+type MessageTransport interface {
+	// ReadMessage blocks until the next message from the peer arrives
+	ReadMessage() (ValidMessage, error)
+	// WriteMessage sends the message to the peer
+	WriteMessage(msg ValidMessage) error
+	// Close closes the transport, and should make a blocked ReadMessage return an error
+	Close() error
+}
+
+// Conn is a net.Conn over an OTR conversation. It runs the AKE over the message transport, and then exposes
+// the data the peer sends as a stream of bytes. Ending the conversation closes the Conn, and when the peer
+// ends the conversation, Read returns io.EOF.
+//
+// The Conn takes over the conversation: all messages from the transport are given to it from a separate goroutine,
+// and the conversation must not be used directly while the Conn is open, except from its handlers.
+// Messages received without encryption are never given to Read.
+type Conn struct {
+	conv      *Conversation
+	transport MessageTransport
+	initiate  bool
+
+	handshakeM    sync.Mutex
+	handshakeDone bool
+	handshakeErr  error
+	querySent     bool
+
+	m             sync.Mutex
+	changed       chan struct{}
+	buffer        []byte
+	readErr       error
+	closed        bool
+	peerClosed    bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+type connAddr struct{}
+
+func (connAddr) Network() string { return "otr" }
+func (connAddr) String() string  { return "otr" }
+
+// NewClientConn returns a Conn that starts the AKE by sending a query message to the peer
+func NewClientConn(conv *Conversation, t MessageTransport) *Conn {
+	return newConn(conv, t, true)
+}
+
+// NewServerConn returns a Conn that waits for the peer to start the AKE
+func NewServerConn(conv *Conversation, t MessageTransport) *Conn {
+	return newConn(conv, t, false)
+}
+
+func newConn(conv *Conversation, t MessageTransport, initiate bool) *Conn {
+	c := &Conn{
+		conv:      conv,
+		transport: t,
+		initiate:  initiate,
+		changed:   make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+// Handshake runs the AKE, unless the conversation is already encrypted. It returns when the AKE has finished, the read deadline
+// has passed or the transport has failed. Read and Write call Handshake, so it doesn't have to be called explicitly.
+// When the deadline passes, the handshake can be continued by calling Handshake again with a later deadline.
+func (c *Conn) Handshake() error {
+	c.handshakeM.Lock()
+	defer c.handshakeM.Unlock()
+
+	if c.handshakeDone {
+		return c.handshakeErr
+	}
+
+	err := c.handshake()
+	if err != os.ErrDeadlineExceeded {
+		c.handshakeDone = true
+		c.handshakeErr = err
+	}
+	return err
+}
+
+// handshake must be called with the handshake lock held
+func (c *Conn) handshake() error {
+	if c.initiate && !c.querySent {
+		if err := c.sendQuery(); err != nil {
+			return err
+		}
+		c.querySent = true
+	}
+
+	return c.waitFor(func() (bool, error) {
+		switch {
+		case c.conv.IsEncrypted():
+			return true, nil
+		case c.closed:
+			return true, net.ErrClosed
+		case c.readErr != nil:
+			return true, c.readErr
+		}
+		return false, nil
+	}, func() time.Time { return c.readDeadline })
+}
+
+func (c *Conn) sendQuery() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.conv.IsEncrypted() {
+		return nil
+	}
+	return c.transport.WriteMessage(c.conv.QueryMessage())
+}
+
+// broadcast wakes up everything waiting in waitFor. It must be called with the lock held.
+func (c *Conn) broadcast() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// waitFor calls done with the lock held, every time something changes, until it returns true or the deadline passes
+func (c *Conn) waitFor(done func() (bool, error), deadline func() time.Time) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for {
+		if ok, err := done(); ok {
+			return err
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if d := deadline(); !d.IsZero() {
+			left := time.Until(d)
+			if left <= 0 {
+				return os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(left)
+			timeout = timer.C
+		}
+
+		changed := c.changed
+		c.m.Unlock()
+		select {
+		case <-changed:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		c.m.Lock()
+	}
+}
+
+func (c *Conn) readLoop() {
+	for {
+		msg, err := c.transport.ReadMessage()
+		if err != nil {
+			c.m.Lock()
+			c.readErr = err
+			if err == io.EOF {
+				c.peerClosed = true
+			}
+			c.broadcast()
+			c.m.Unlock()
+			return
+		}
+
+		c.receive(msg)
+	}
+}
+
+func (c *Conn) receive(msg ValidMessage) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	wasEncrypted := c.conv.IsEncrypted()
+	plaintext := isPlaintextMessage(c.conv, msg)
+	plain, toSend, err := c.conv.Receive(msg)
+	if err == nil {
+		for _, m := range toSend {
+			if err = c.transport.WriteMessage(m); err != nil {
+				break
+			}
+		}
+	}
+
+	if err != nil && !wasEncrypted && !c.conv.IsEncrypted() {
+		c.readErr = err
+	}
+
+	if wasEncrypted && !plaintext && len(plain) > 0 {
+		c.buffer = append(c.buffer, unescapeStreamData(plain)...)
+	}
+
+	if wasEncrypted && c.conv.msgState == finished {
+		c.peerClosed = true
+	}
+
+	c.broadcast()
+}
+
+func isPlaintextMessage(conv *Conversation, msg ValidMessage) bool {
+	if conv.binaryTransport && isBinaryFrame(msg) {
+		return false
+	}
+
+	switch guessMessageType(msg) {
+	case msgGuessNotOTR, msgGuessTaggedPlaintext, msgGuessError:
+		return true
+	}
+	return false
+}
+
+// Read reads data the peer has sent in the encrypted conversation
+func (c *Conn) Read(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+
+	var n int
+	err := c.waitFor(func() (bool, error) {
+		switch {
+		case len(c.buffer) > 0:
+			n = copy(b, c.buffer)
+			c.buffer = c.buffer[n:]
+			return true, nil
+		case c.closed:
+			return true, net.ErrClosed
+		case c.peerClosed:
+			return true, io.EOF
+		case c.readErr != nil:
+			return true, c.readErr
+		}
+		return false, nil
+	}, func() time.Time { return c.readDeadline })
+
+	return n, err
+}
+
+// Write encrypts the data and sends it to the peer
+func (c *Conn) Write(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+
+	if !c.writeDeadline.IsZero() && !time.Now().Before(c.writeDeadline) {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	toSend, err := c.conv.Send(escapeStreamData(b))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, m := range toSend {
+		if err := c.transport.WriteMessage(m); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// Close ends the conversation, letting the peer know if it was encrypted, and closes the transport
+func (c *Conn) Close() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.closed {
+		return net.ErrClosed
+	}
+	c.closed = true
+	defer c.broadcast()
+
+	toSend, _ := c.conv.End()
+	for _, m := range toSend {
+		if err := c.transport.WriteMessage(m); err != nil {
+			_ = c.transport.Close()
+			return err
+		}
+	}
+
+	return c.transport.Close()
+}
+
+// LocalAddr returns the local address of the transport, if it has one
+func (c *Conn) LocalAddr() net.Addr {
+	if t, ok := c.transport.(interface{ LocalAddr() net.Addr }); ok {
+		return t.LocalAddr()
+	}
+	return connAddr{}
+}
+
+// RemoteAddr returns the remote address of the transport, if it has one
+func (c *Conn) RemoteAddr() net.Addr {
+	if t, ok := c.transport.(interface{ RemoteAddr() net.Addr }); ok {
+		return t.RemoteAddr()
+	}
+	return connAddr{}
+}
+
+// SetDeadline sets both the read and the write deadlines
+func (c *Conn) SetDeadline(t time.Time) error {
+	_ = c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for Read and Handshake. A zero value means they never time out.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.readDeadline = t
+	c.broadcast()
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for Write. It is also given to the transport if it supports write deadlines,
+// since that is the only place where Write can block.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.writeDeadline = t
+	if tr, ok := c.transport.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		return tr.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+// The plain text of a data message ends at the first NUL byte, so NUL bytes in the stream are escaped
+const (
+	streamEscape    = 0x01
+	streamEscapeNUL = 0x01
+	streamEscapeOwn = 0x02
+)
+
+func escapeStreamData(b []byte) ValidMessage {
+	res := make([]byte, 0, len(b))
+	for _, v := range b {
+		switch v {
+		case 0x00:
+			res = append(res, streamEscape, streamEscapeNUL)
+		case streamEscape:
+			res = append(res, streamEscape, streamEscapeOwn)
+		default:
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func unescapeStreamData(b []byte) []byte {
+	res := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		if b[i] == streamEscape && i+1 < len(b) {
+			i++
+			if b[i] == streamEscapeNUL {
+				res = append(res, 0x00)
+			} else {
+				res = append(res, streamEscape)
+			}
+			continue
+		}
+		res = append(res, b[i])
+	}
+	return res
+}
@@ -0,0 +1,228 @@
+package otr3
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+var _ net.Conn = &Conn{}
+
+type pipeTransport struct {
+	in   chan ValidMessage
+	out  chan ValidMessage
+	done chan struct{}
+	once sync.Once
+
+	m       sync.Mutex
+	written []ValidMessage
+}
+
+func pipeTransports() (*pipeTransport, *pipeTransport) {
+	ab, ba := make(chan ValidMessage, 100), make(chan ValidMessage, 100)
+	return &pipeTransport{in: ba, out: ab, done: make(chan struct{})}, &pipeTransport{in: ab, out: ba, done: make(chan struct{})}
+}
+
+func (p *pipeTransport) ReadMessage() (ValidMessage, error) {
+	select {
+	case m, ok := <-p.in:
+		if !ok {
+			return nil, io.EOF
+		}
+		return m, nil
+	case <-p.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (p *pipeTransport) WriteMessage(msg ValidMessage) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.written = append(p.written, msg)
+	select {
+	case p.out <- msg:
+		return nil
+	case <-p.done:
+		return net.ErrClosed
+	}
+}
+
+func (p *pipeTransport) Close() error {
+	p.once.Do(func() { close(p.done) })
+	return nil
+}
+
+func connPair(t *testing.T) (client, server *Conn) {
+	alice := &Conversation{Rand: rand.Reader}
+	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
+	alice.Policies = policies(allowV3)
+
+	bob := &Conversation{Rand: rand.Reader}
+	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
+	bob.Policies = policies(allowV3)
+
+	a, b := pipeTransports()
+	client, server = NewClientConn(alice, a), NewServerConn(bob, b)
+
+	deadline := time.Now().Add(5 * time.Second)
+	client.SetDeadline(deadline)
+	server.SetDeadline(deadline)
+	assertNil(t, client.Handshake())
+	assertNil(t, server.Handshake())
+	return
+}
+
+func Test_Conn_runsTheAKEAndCarriesAStreamOfBytes(t *testing.T) {
+	client, server := connPair(t)
+	assertEquals(t, client.conv.IsEncrypted(), true)
+	assertEquals(t, server.conv.IsEncrypted(), true)
+
+	data := []byte("hello\x00world\x01\x01\x00")
+	n, err := client.Write(data)
+	assertNil(t, err)
+	assertEquals(t, n, len(data))
+	_, err = client.Write([]byte(" again"))
+	assertNil(t, err)
+
+	res := make([]byte, len(data)+6)
+	_, err = io.ReadFull(server, res)
+	assertNil(t, err)
+	assertDeepEquals(t, res, append(data, []byte(" again")...))
+
+	_, err = server.Write([]byte("pong"))
+	assertNil(t, err)
+	res = make([]byte, 4)
+	_, err = io.ReadFull(client, res)
+	assertNil(t, err)
+	assertDeepEquals(t, res, []byte("pong"))
+}
+
+func Test_Conn_sendsTheDataEncrypted(t *testing.T) {
+	client, _ := connPair(t)
+	_, err := client.Write([]byte("a secret"))
+	assertNil(t, err)
+
+	tr := client.transport.(*pipeTransport)
+	tr.m.Lock()
+	defer tr.m.Unlock()
+	for _, m := range tr.written {
+		assertEquals(t, bytes.Contains(m, []byte("a secret")), false)
+	}
+}
+
+func Test_Conn_readReturnsEOFWhenThePeerEndsTheConversation(t *testing.T) {
+	client, server := connPair(t)
+	_, _ = client.Write([]byte("bye"))
+	assertNil(t, client.Close())
+
+	data, err := io.ReadAll(server)
+	assertNil(t, err)
+	assertDeepEquals(t, data, []byte("bye"))
+
+	_, err = server.Write([]byte("hello?"))
+	assertEquals(t, err, newOtrError("cannot send message because secure conversation has finished"))
+}
+
+func Test_Conn_readTimesOutAtTheDeadline(t *testing.T) {
+	client, _ := connPair(t)
+	client.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+
+	_, err := client.Read(make([]byte, 10))
+	assertEquals(t, err, os.ErrDeadlineExceeded)
+	ne, ok := err.(net.Error)
+	assertEquals(t, ok && ne.Timeout(), true)
+}
+
+func Test_Conn_settingADeadlineWakesUpABlockedRead(t *testing.T) {
+	client, _ := connPair(t)
+	client.SetReadDeadline(time.Time{})
+
+	res := make(chan error)
+	go func() {
+		_, err := client.Read(make([]byte, 10))
+		res <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	client.SetReadDeadline(time.Now())
+	assertEquals(t, <-res, os.ErrDeadlineExceeded)
+}
+
+func Test_Conn_handshakeTimesOutWithoutAPeer(t *testing.T) {
+	alice := &Conversation{Rand: rand.Reader}
+	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
+	alice.Policies = policies(allowV3)
+	a, _ := pipeTransports()
+
+	c := NewClientConn(alice, a)
+	c.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	assertEquals(t, c.Handshake(), os.ErrDeadlineExceeded)
+	_, err := c.Write([]byte("hello"))
+	assertEquals(t, err, os.ErrDeadlineExceeded)
+}
+
+func Test_Conn_handshakeCanContinueAfterTheDeadline(t *testing.T) {
+	alice := &Conversation{Rand: rand.Reader}
+	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
+	alice.Policies = policies(allowV3)
+	bob := &Conversation{Rand: rand.Reader}
+	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
+	bob.Policies = policies(allowV3)
+	a, b := pipeTransports()
+
+	client := NewClientConn(alice, a)
+	client.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	assertEquals(t, client.Handshake(), os.ErrDeadlineExceeded)
+
+	server := NewServerConn(bob, b)
+	client.SetReadDeadline(time.Time{})
+	assertNil(t, client.Handshake())
+	assertNil(t, server.Handshake())
+
+	a.m.Lock()
+	defer a.m.Unlock()
+	queries := 0
+	for _, m := range a.written {
+		if guessMessageType(m) == msgGuessQuery {
+			queries++
+		}
+	}
+	assertEquals(t, queries, 1)
+}
+
+func Test_Conn_failsAfterClose(t *testing.T) {
+	client, _ := connPair(t)
+	assertNil(t, client.Close())
+
+	_, err := client.Read(make([]byte, 10))
+	assertEquals(t, err, net.ErrClosed)
+	_, err = client.Write([]byte("hello"))
+	assertEquals(t, err, net.ErrClosed)
+	assertEquals(t, client.Close(), net.ErrClosed)
+}
+
+func Test_Conn_ignoresUnencryptedMessages(t *testing.T) {
+	client, server := connPair(t)
+	client.transport.(*pipeTransport).out <- ValidMessage("injected plain text")
+	_, _ = client.Write([]byte("real"))
+
+	res := make([]byte, 4)
+	_, err := io.ReadFull(server, res)
+	assertNil(t, err)
+	assertDeepEquals(t, res, []byte("real"))
+}
+
+func Test_escapeStreamData_roundTripsAllBytes(t *testing.T) {
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	escaped := escapeStreamData(data)
+	assertEquals(t, bytes.IndexByte(escaped, 0), -1)
+	assertDeepEquals(t, unescapeStreamData(escaped), data)
+}
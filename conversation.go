@@ -46,14 +46,36 @@ type Conversation struct {
 	resend     resendContext
 	injections injections
 
-	fragmentSize         uint16
-	fragmentationContext fragmentationContext
+	smpTimeout             time.Duration
+	smpSecretNormalization SMPSecretNormalization
+	asyncSMP               bool
+
+	akeTimeouts AKETimeouts
+	akeRetry    *akeRetryContext
+
+	paddingPolicy PaddingPolicy
+
+	fragmentSize          uint16
+	fragmentPolicy        FragmentPolicy
+	messageInjector       MessageInjector
+	maxMessageSizeHandler MaxMessageSizeHandler
+	fragmentationContext  fragmentationContext
+	binaryTransport       bool
+	htmlAware             bool
+	lenientDecoding       bool
+	findEmbedded          bool
 
 	smpEventHandler      SMPEventHandler
 	errorMessageHandler  ErrorMessageHandler
 	messageEventHandler  MessageEventHandler
 	securityEventHandler SecurityEventHandler
 	receivedKeyHandler   ReceivedKeyHandler
+	keyRotationHandler   KeyRotationHandler
+	smpSecretProvider    SMPSecretProvider
+	messageConverter     MessageConverter
+
+	trustStore   TrustStore
+	verification *VerificationRecord
 
 	debug         bool
 	sentRevealSig bool
@@ -114,12 +136,14 @@ func (c *Conversation) IsEncrypted() bool {
 func (c *Conversation) End() (toSend []ValidMessage, err error) {
 	previousMsgState := c.msgState
 	if c.msgState == encrypted {
+		c.waitForSMP()
 		c.smp.wipe()
 		// Error can only happen when Rand reader is broken
 		toSend, _, err = c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, []tlv{{tlvType: tlvTypeDisconnected}})
 	}
 	c.lastMessageStateChange = time.Time{}
 	c.ake = nil
+	c.verification = nil
 	c.msgState = plainText
 	defer c.signalSecurityEventIf(previousMsgState == encrypted, GoneInsecure)
 
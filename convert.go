@@ -0,0 +1,106 @@
+package otr3
+
+import (
+	"bytes"
+	"html"
+)
+
+// ConvertType tells a MessageConverter which direction a message is going in, like the OtrlConvertType of libotr
+type ConvertType int
+
+const (
+	// ConvertSending is used for messages from the local user, right before they are encrypted
+	ConvertSending ConvertType = iota
+	// ConvertReceiving is used for messages from the peer, right after they have been decrypted
+	ConvertReceiving
+)
+
+// MessageConverter changes the messages that are sent and received in an encrypted conversation,
+// for example to strip or escape markup. It corresponds to the convert_msg operation of libotr.
+type MessageConverter interface {
+	// ConvertMessage returns the converted message. The message given to it must not be kept, since it will be wiped.
+	ConvertMessage(t ConvertType, msg []byte) []byte
+}
+
+type dynamicMessageConverter struct {
+	f func(t ConvertType, msg []byte) []byte
+}
+
+func (d dynamicMessageConverter) ConvertMessage(t ConvertType, msg []byte) []byte {
+	return d.f(t, msg)
+}
+
+// SetMessageConverter sets the converter that is used for all messages encrypted by Send and decrypted by Receive
+func (c *Conversation) SetMessageConverter(mc MessageConverter) {
+	c.messageConverter = mc
+}
+
+func (c *Conversation) convertMessage(t ConvertType, msg []byte) []byte {
+	if c.messageConverter == nil || len(msg) == 0 {
+		return msg
+	}
+	return c.messageConverter.ConvertMessage(t, msg)
+}
+
+// SetHTMLAware makes Receive look for query messages, error messages and whitespace tags in the text of
+// HTML messages, for networks where clients send HTML bodies and might add markup around them.
+func (c *Conversation) SetHTMLAware(v bool) {
+	c.htmlAware = v
+}
+
+// StripHTML returns the text of an HTML message, without any markup and with all entities decoded.
+// Non-breaking spaces are turned into normal spaces, since HTML editors use them to keep whitespace.
+func StripHTML(msg []byte) []byte {
+	var text []byte
+	inTag := false
+	for _, b := range msg {
+		switch {
+		case inTag:
+			inTag = b != '>'
+		case b == '<':
+			inTag = true
+		default:
+			text = append(text, b)
+		}
+	}
+
+	unescaped := html.UnescapeString(string(text))
+	return bytes.Replace([]byte(unescaped), []byte("\u00a0"), []byte(" "), -1)
+}
+
+// guessMessageTypeInHTML looks for messages that are only recognizable once the markup has been removed
+func guessMessageTypeInHTML(message []byte) (messageTypeGuess, []byte) {
+	stripped := StripHTML(message)
+	switch guess := guessMessageType(stripped); guess {
+	case msgGuessQuery, msgGuessError, msgGuessTaggedPlaintext:
+		return guess, stripped
+	}
+	return msgGuessNotOTR, message
+}
+
+func (c *Conversation) receiveHTML(guess messageTypeGuess, message, stripped []byte, forgetFragments bool) (plain MessagePlaintext, toSend []ValidMessage, err error) {
+	var messagesToSend []messageWithHeader
+	switch guess {
+	case msgGuessError:
+		return c.withInjectionsPlain(c.receiveErrorMessage(stripped))
+	case msgGuessQuery:
+		messagesToSend, err = c.receiveQueryMessage(stripped)
+	case msgGuessTaggedPlaintext:
+		plain, messagesToSend, err = c.receiveTaggedHTML(message, stripped)
+	}
+
+	if forgetFragments {
+		c.fragmentationContext = forgetFragment()
+	}
+
+	return c.withInjectionsPlain(c.toSendEncoded(plain, messagesToSend, err))
+}
+
+// receiveTaggedHTML starts the AKE from a whitespace tag that was only found in the text of the HTML message.
+// The message is returned as is, since the tag can't be removed without changing the markup.
+func (c *Conversation) receiveTaggedHTML(message, stripped []byte) (plain MessagePlaintext, toSend []messageWithHeader, err error) {
+	_, toSend, err = c.processWhitespaceTag(stripped)
+	plain = MessagePlaintext(makeCopy(message))
+	c.checkPlaintextPolicies(plain)
+	return
+}
@@ -0,0 +1,112 @@
+package otr3
+
+import (
+	"bytes"
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+func recordingConverter(log *[]ConvertType) MessageConverter {
+	return dynamicMessageConverter{func(t ConvertType, msg []byte) []byte {
+		*log = append(*log, t)
+		if t == ConvertSending {
+			return bytes.ToUpper(msg)
+		}
+		return append([]byte("received: "), msg...)
+	}}
+}
+
+func Test_MessageConverter_convertsMessagesBeforeEncryptionAndAfterDecryption(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	var aliceLog, bobLog []ConvertType
+	alice.SetMessageConverter(recordingConverter(&aliceLog))
+	bob.SetMessageConverter(recordingConverter(&bobLog))
+
+	msgs, err := alice.Send(ValidMessage("hello"))
+	assertNil(t, err)
+	plain, _, err := bob.Receive(msgs[0])
+	assertNil(t, err)
+
+	assertEquals(t, string(plain), "received: HELLO")
+	assertDeepEquals(t, aliceLog, []ConvertType{ConvertSending})
+	assertDeepEquals(t, bobLog, []ConvertType{ConvertReceiving})
+}
+
+func Test_MessageConverter_isNotUsedForUnencryptedMessages(t *testing.T) {
+	c := &Conversation{}
+	c.Policies = policies(allowV3)
+	var log []ConvertType
+	c.SetMessageConverter(recordingConverter(&log))
+
+	msgs, _ := c.Send(ValidMessage("hello"))
+	assertDeepEquals(t, msgs, []ValidMessage{ValidMessage("hello")})
+	plain, _, _ := c.Receive(ValidMessage("hi"))
+	assertDeepEquals(t, plain, MessagePlaintext("hi"))
+	assertEquals(t, len(log), 0)
+}
+
+func Test_MessageConverter_isUsedForRetransmittedMessages(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	var log []ConvertType
+	alice.SetMessageConverter(recordingConverter(&log))
+	alice.lastMessage(MessagePlaintext("hello"))
+	alice.updateMayRetransmitTo(retransmitExact)
+
+	toSend, err := alice.retransmit()
+	assertNil(t, err)
+	plain, _, _ := bob.Receive(ValidMessage(alice.encode(toSend[0])))
+	assertEquals(t, string(plain), "HELLO")
+}
+
+func Test_StripHTML_removesMarkupAndDecodesEntities(t *testing.T) {
+	assertEquals(t, string(StripHTML([]byte(`<p class="x">Hello &amp; <b>welcome</b>&nbsp;&lt;3</p>`))), "Hello & welcome <3")
+	assertEquals(t, string(StripHTML([]byte("no markup"))), "no markup")
+}
+
+func Test_Receive_findsAQueryMessageInHTMLWhenHTMLAware(t *testing.T) {
+	bob := &Conversation{Rand: rand.Reader}
+	bob.Policies = policies(allowV3)
+	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
+
+	plain, toSend, err := bob.Receive(ValidMessage("<html><body>?OTRv3?</body></html>"))
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("<html><body>?OTRv3?</body></html>"))
+	assertEquals(t, len(toSend), 0)
+
+	bob.SetHTMLAware(true)
+	plain, toSend, err = bob.Receive(ValidMessage("<html><body>?OTRv3?</body></html>"))
+	assertNil(t, err)
+	assertNil(t, plain)
+	assertEquals(t, len(toSend), 1)
+	assertEquals(t, guessMessageType(toSend[0]), msgGuessDHCommit)
+}
+
+func Test_Receive_findsAnErrorMessageInHTMLWhenHTMLAware(t *testing.T) {
+	c := &Conversation{}
+	c.Policies = policies(allowV3)
+	c.SetHTMLAware(true)
+
+	c.expectMessageEvent(t, func() {
+		_, _, _ = c.Receive(ValidMessage("<b>?OTR Error:</b> something &quot;bad&quot; happened"))
+	}, MessageEventReceivedMessageGeneralError, []byte(`something "bad" happened`), nil)
+}
+
+func Test_Receive_findsAWhitespaceTagWrittenWithEntitiesWhenHTMLAware(t *testing.T) {
+	alice := &Conversation{}
+	alice.Policies = policies(allowV3 | sendWhitespaceTag)
+	bob := &Conversation{Rand: rand.Reader}
+	bob.Policies = policies(allowV3 | whitespaceStartAKE)
+	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
+	bob.SetHTMLAware(true)
+
+	msgs, _ := alice.Send(ValidMessage("hello"))
+	tagged := strings.NewReplacer(" ", "&nbsp;", "\t", "&#9;").Replace(string(msgs[0]))
+	html := "<p>" + tagged + "</p>"
+
+	plain, toSend, err := bob.Receive(ValidMessage(html))
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext(html))
+	assertEquals(t, len(toSend), 1)
+	assertEquals(t, guessMessageType(toSend[0]), msgGuessDHCommit)
+}
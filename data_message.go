@@ -20,6 +20,11 @@ func (c *Conversation) genDataMsgWithFlag(message []byte, flag byte, tlvs ...tlv
 		return dataMsg{}, dataMessageExtra{}, err
 	}
 
+	plain, err := c.padPlaintext(plainDataMsg{message: message, tlvs: tlvs}, c.rand())
+	if err != nil {
+		return dataMsg{}, dataMessageExtra{}, err
+	}
+
 	topHalfCtr := [8]byte{}
 	counter := c.keys.counterHistory.findCounterFor(c.keys.ourKeyID-1, c.keys.theirKeyID)
 	if counter.ourCounter == 0 {
@@ -29,12 +34,7 @@ func (c *Conversation) genDataMsgWithFlag(message []byte, flag byte, tlvs ...tlv
 	binary.BigEndian.PutUint64(topHalfCtr[:], counter.ourCounter)
 	counter.ourCounter++
 
-	plain := plainDataMsg{
-		message: message,
-		tlvs:    tlvs,
-	}
-
-	encrypted := plain.encrypt(keys.sendingAESKey, topHalfCtr)
+	encrypted := encryptSerialized(keys.sendingAESKey, topHalfCtr, plain.serialize())
 
 	header, err := c.messageHeader(msgTypeData)
 	if err != nil {
@@ -87,10 +87,13 @@ func (c *Conversation) createSerializedDataMessage(msg []byte, flag byte, tlvs [
 }
 
 func (c *Conversation) fragEncode(msg messageWithHeader) []ValidMessage {
-	return c.fragment(c.encode(msg), c.fragmentSize)
+	return c.fragment(c.encode(msg), c.currentFragmentSize())
 }
 
 func (c *Conversation) encode(msg messageWithHeader) encodedMessage {
+	if c.binaryTransport {
+		return encodeBinary(msg)
+	}
 	return append(append(msgMarker, b64encode(msg)...), '.')
 }
 
@@ -184,6 +187,7 @@ func decideFlagFrom(tlvs []tlv) byte {
 }
 
 func (c *Conversation) processSMPTLV(t tlv, x dataMessageExtra) (toSend *tlv, err error) {
+	c.waitForSMP()
 	c.smp.ensureSMP()
 
 	smpMessage, ok := t.smpMessage()
@@ -191,7 +195,17 @@ func (c *Conversation) processSMPTLV(t tlv, x dataMessageExtra) (toSend *tlv, er
 		return nil, newOtrError("corrupt data message")
 	}
 
-	return c.receiveSMP(smpMessage)
+	tlvs, err := c.runSMPStep(messageFlagIgnoreUnreadable, func(c *Conversation) ([]tlv, error) {
+		t, err := c.receiveSMP(smpMessage)
+		if t == nil {
+			return nil, err
+		}
+		return []tlv{*t}, err
+	})
+	if err != nil || len(tlvs) == 0 {
+		return nil, err
+	}
+	return &tlvs[0], nil
 }
 
 func (c *Conversation) processTLVs(tlvs []tlv, x dataMessageExtra) ([]tlv, error) {
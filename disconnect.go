@@ -8,8 +8,10 @@ func (c *Conversation) processDisconnectedTLV(t tlv, x dataMessageExtra) (toSend
 	defer c.signalSecurityEventIf(previousMsgState == encrypted, GoneInsecure)
 	c.lastMessageStateChange = time.Time{}
 	c.msgState = finished
+	c.waitForSMP()
 	c.smp.wipe()
 	c.ake = nil
+	c.verification = nil
 
 	c.keys = keyManagementContext{}
 
@@ -0,0 +1,92 @@
+package otr3
+
+import "bytes"
+
+// fragmentCommas is the number of commas in a fragment, the last one ending it
+const fragmentCommas = 4
+
+// SetEmbeddedMessageDetection makes Receive look for OTR messages that are surrounded by other text, and report that
+// text with MessageEventReceivedMessageWithSurroundingText. It is off by default, since any plaintext message that
+// happens to contain an OTR marker would otherwise be handled as an OTR message. It complements SetHTMLAware, which
+// only looks at messages that are nothing but markup around an OTR message.
+func (c *Conversation) SetEmbeddedMessageDetection(v bool) {
+	c.findEmbedded = v
+}
+
+// findOTRMessage finds an OTR message that is surrounded by other text, like libotr does. This happens when clients
+// or bridges add nicknames, quote markers or HTML markup around messages. It returns the OTR message and the text
+// around it. Query and error messages that start the message are left alone, since text after them is expected.
+func findOTRMessage(msg []byte) (otr, surrounding []byte, ok bool) {
+	start := bytes.Index(msg, queryMarker)
+	if start < 0 {
+		return nil, nil, false
+	}
+
+	rest := msg[start:]
+	end := embeddedMessageLength(rest)
+	if end == 0 || (start == 0 && (end == len(rest) || !isEncodedOrFragment(rest))) {
+		return nil, nil, false
+	}
+
+	surrounding = append(makeCopy(msg[:start]), rest[end:]...)
+	return makeCopy(rest[:end]), surrounding, true
+}
+
+func isEncodedOrFragment(msg []byte) bool {
+	return bytes.HasPrefix(msg, msgMarker) ||
+		bytes.HasPrefix(msg, otrv3FragmentationPrefix) ||
+		bytes.HasPrefix(msg, otrv2FragmentationPrefix)
+}
+
+// embeddedMessageLength returns the length of the OTR message at the start of msg, or zero if it doesn't end
+func embeddedMessageLength(msg []byte) int {
+	switch {
+	case bytes.HasPrefix(msg, errorMarker):
+		return len(msg)
+	case bytes.HasPrefix(msg, msgMarker):
+		return bytes.IndexByte(msg, '.') + 1
+	case bytes.HasPrefix(msg, otrv3FragmentationPrefix), bytes.HasPrefix(msg, otrv2FragmentationPrefix):
+		commas := 0
+		for i, b := range msg {
+			if b == fragmentSeparator[0] {
+				commas++
+				if commas == fragmentCommas {
+					return i + 1
+				}
+			}
+		}
+	default:
+		return queryMessageLength(msg)
+	}
+	return 0
+}
+
+// queryMessageLength returns the length of a query message like ?OTR?, ?OTRv23? or ?OTR?v2?
+func queryMessageLength(msg []byte) int {
+	i := len(queryMarker)
+	if i < len(msg) && msg[i] == '?' {
+		i++
+		if i == len(msg) || msg[i] != 'v' {
+			return i
+		}
+	}
+
+	if i == len(msg) || msg[i] != 'v' {
+		return 0
+	}
+
+	end := bytes.IndexByte(msg[i:], '?')
+	if end < 0 {
+		return 0
+	}
+	return i + end + 1
+}
+
+// surroundingText lets the application know about text that was found around an OTR message,
+// unless it was only whitespace or markup
+func (c *Conversation) surroundingText(text []byte) {
+	if len(bytes.TrimSpace(StripHTML(text))) == 0 {
+		return
+	}
+	c.messageEventWithMessage(MessageEventReceivedMessageWithSurroundingText, text)
+}
@@ -0,0 +1,114 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+func Test_findOTRMessage_findsMessagesAfterOtherText(t *testing.T) {
+	otr, surrounding, ok := findOTRMessage([]byte("<alice> ?OTR:AAMDabc. :)"))
+	assertEquals(t, ok, true)
+	assertEquals(t, string(otr), "?OTR:AAMDabc.")
+	assertEquals(t, string(surrounding), "<alice>  :)")
+}
+
+func Test_findOTRMessage_findsFragments(t *testing.T) {
+	otr, surrounding, ok := findOTRMessage([]byte("> ?OTR|00000101|00000102,00001,00002,abc,def"))
+	assertEquals(t, ok, true)
+	assertEquals(t, string(otr), "?OTR|00000101|00000102,00001,00002,abc,")
+	assertEquals(t, string(surrounding), "> def")
+
+	otr, _, ok = findOTRMessage([]byte("> ?OTR,00001,00002,abc,"))
+	assertEquals(t, ok, true)
+	assertEquals(t, string(otr), "?OTR,00001,00002,abc,")
+}
+
+func Test_findOTRMessage_findsQueryAndErrorMessages(t *testing.T) {
+	otr, surrounding, _ := findOTRMessage([]byte("bob: ?OTRv23? Let's talk"))
+	assertEquals(t, string(otr), "?OTRv23?")
+	assertEquals(t, string(surrounding), "bob:  Let's talk")
+
+	otr, _, _ = findOTRMessage([]byte("bob: ?OTR?v2? hi"))
+	assertEquals(t, string(otr), "?OTR?v2?")
+
+	otr, _, _ = findOTRMessage([]byte("bob: ?OTR? hi"))
+	assertEquals(t, string(otr), "?OTR?")
+
+	otr, surrounding, _ = findOTRMessage([]byte("bob: ?OTR Error: bad things"))
+	assertEquals(t, string(otr), "?OTR Error: bad things")
+	assertEquals(t, string(surrounding), "bob: ")
+}
+
+func Test_findOTRMessage_leavesNormalMessagesAlone(t *testing.T) {
+	for _, m := range []string{"hello", "?OTRv3? Let's talk", "?OTR Error: bad", "?OTR:AAMDabc.", "what is ?OTR anyway", "a ?OTR:AAMDabc", "a ?OTR|1|2,1,2,ab"} {
+		_, _, ok := findOTRMessage([]byte(m))
+		assertEquals(t, ok, false)
+	}
+}
+
+func Test_Receive_decryptsADataMessageSurroundedByText(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	bob.SetEmbeddedMessageDetection(true)
+	var surrounding []string
+	bob.SetMessageEventHandler(dynamicMessageEventHandler{func(e MessageEvent, m []byte, _ error, _ ...interface{}) {
+		if e == MessageEventReceivedMessageWithSurroundingText {
+			surrounding = append(surrounding, string(m))
+		}
+	}})
+
+	msgs, _ := alice.Send(ValidMessage("hello"))
+	plain, _, err := bob.Receive(ValidMessage("[12:00] <alice> " + string(msgs[0]) + "\n"))
+	assertNil(t, err)
+	assertEquals(t, string(plain), "hello")
+	assertDeepEquals(t, surrounding, []string{"[12:00] <alice> \n"})
+}
+
+func Test_Receive_decryptsFragmentsInHTMLWithoutSignalingMarkup(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	alice.SetFragmentSize(150)
+	bob.SetEmbeddedMessageDetection(true)
+	signaled := false
+	bob.SetMessageEventHandler(dynamicMessageEventHandler{func(e MessageEvent, _ []byte, _ error, _ ...interface{}) {
+		signaled = signaled || e == MessageEventReceivedMessageWithSurroundingText
+	}})
+
+	message := strings.Repeat("hello ", 50)
+	msgs, _ := alice.Send(ValidMessage(message))
+	assertEquals(t, len(msgs) > 1, true)
+
+	var plain MessagePlaintext
+	for _, m := range msgs {
+		p, _, err := bob.Receive(ValidMessage(`<body><p style="x">` + string(m) + "</p></body>"))
+		assertNil(t, err)
+		if p != nil {
+			plain = p
+		}
+	}
+	assertEquals(t, string(plain), message)
+	assertEquals(t, signaled, false)
+}
+
+func Test_Receive_startsTheAKEFromAQueryMessageAfterANickname(t *testing.T) {
+	bob := &Conversation{Rand: rand.Reader}
+	bob.Policies = policies(allowV3)
+	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
+	bob.SetEmbeddedMessageDetection(true)
+
+	plain, toSend, err := bob.Receive(ValidMessage("<alice> ?OTRv3?"))
+	assertNil(t, err)
+	assertNil(t, plain)
+	assertEquals(t, len(toSend), 1)
+	assertEquals(t, guessMessageType(toSend[0]), msgGuessDHCommit)
+}
+
+func Test_Receive_leavesEmbeddedMessagesAloneByDefault(t *testing.T) {
+	bob := &Conversation{Rand: rand.Reader}
+	bob.Policies = policies(allowV3)
+	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
+
+	plain, toSend, err := bob.Receive(ValidMessage("<alice> ?OTRv3?"))
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("<alice> ?OTRv3?"))
+	assertEquals(t, len(toSend), 0)
+}
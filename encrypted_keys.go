@@ -0,0 +1,269 @@
+package otr3
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/coyim/otr3/sexp"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	encryptedKeyFileForm      = "encrypted-privkeys"
+	encryptedKeyFileKDF       = "argon2id"
+	encryptedKeyFileCipher    = "aes-256-gcm"
+	encryptedKeyFileSaltLen   = 16
+	encryptedKeyFileKeyLength = 32
+
+	// The most expensive KDF parameters accepted, a small multiple of the defaults, so that a hostile or corrupt
+	// key file can't make us spend a lot of memory or time before the passphrase is checked
+	maxKeyFileKDFTime   = 10
+	maxKeyFileKDFMemory = 1024 * 1024
+)
+
+// KeyFileKDFParameters decides how expensive it is to derive the encryption key of an encrypted key file from its passphrase.
+// Time is the number of passes over the memory, Memory is the amount of memory to use in KiB, and Threads the degree of parallelism.
+// Key files with a Time above 10 or a Memory above 1 GiB are rejected, so they can't be written either.
+type KeyFileKDFParameters struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// DefaultKeyFileKDFParameters are the Argon2id parameters used when writing new encrypted key files
+var DefaultKeyFileKDFParameters = KeyFileKDFParameters{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+var errWrongPassphraseOrCorruptKeyFile = newOtrError("couldn't decrypt private keys: wrong passphrase or corrupt data")
+
+var (
+	errInvalidKeyFileKDFParameters   = errors.New("invalid kdf parameters")
+	errExpensiveKeyFileKDFParameters = errors.New("kdf parameters are too expensive")
+)
+
+type encryptedKeyFile struct {
+	KDF    encryptedKeyFileKDFForm `sexp:"kdf"`
+	Cipher string                  `sexp:"cipher,symbol"`
+	Nonce  string                  `sexp:"nonce"`
+	Data   string                  `sexp:"data"`
+}
+
+type encryptedKeyFileKDFForm struct {
+	Algorithm string   `sexp:"algorithm,symbol"`
+	Salt      string   `sexp:"salt"`
+	Time      *big.Int `sexp:"time"`
+	Memory    *big.Int `sexp:"memory"`
+	Threads   *big.Int `sexp:"threads"`
+}
+
+func (k encryptedKeyFileKDFForm) parameters() (KeyFileKDFParameters, error) {
+	if k.Time == nil || k.Memory == nil || k.Threads == nil ||
+		!k.Time.IsUint64() || !k.Memory.IsUint64() || !k.Threads.IsUint64() ||
+		k.Threads.Uint64() > 255 {
+		return KeyFileKDFParameters{}, errInvalidKeyFileKDFParameters
+	}
+	if k.Time.Uint64() > maxKeyFileKDFTime || k.Memory.Uint64() > maxKeyFileKDFMemory {
+		return KeyFileKDFParameters{}, errExpensiveKeyFileKDFParameters
+	}
+
+	p := KeyFileKDFParameters{
+		Time:    uint32(k.Time.Uint64()),
+		Memory:  uint32(k.Memory.Uint64()),
+		Threads: uint8(k.Threads.Uint64()),
+	}
+	return p, p.validate()
+}
+
+func (p KeyFileKDFParameters) validate() error {
+	switch {
+	case p.Time == 0 || p.Memory == 0 || p.Threads == 0:
+		return errInvalidKeyFileKDFParameters
+	case p.Time > maxKeyFileKDFTime || p.Memory > maxKeyFileKDFMemory:
+		return errExpensiveKeyFileKDFParameters
+	}
+	return nil
+}
+
+// associatedData returns the KDF and cipher description, which is authenticated together with the encrypted keys
+func (f encryptedKeyFile) associatedData() ([]byte, error) {
+	v, err := sexp.Marshal(encryptedKeyFile{KDF: f.KDF, Cipher: f.Cipher})
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := sexp.EncodeCanonical(&b, v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func deriveKeyFileKey(passphrase []byte, salt []byte, p KeyFileKDFParameters) (cipher.AEAD, error) {
+	key := argon2.IDKey(passphrase, salt, p.Time, p.Memory, p.Threads, encryptedKeyFileKeyLength)
+	defer wipeBytes(key)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ExportEncryptedKeys will write all the accounts to the writer in the same libotr format as ExportKeysToFile,
+// but encrypted with a key derived from the passphrase, using Argon2id and AES-256-GCM.
+func ExportEncryptedKeys(acs []*Account, w io.Writer, passphrase []byte) error {
+	return exportEncryptedAccounts(acs, w, passphrase, DefaultKeyFileKDFParameters, rand.Reader)
+}
+
+func exportEncryptedAccounts(acs []*Account, w io.Writer, passphrase []byte, p KeyFileKDFParameters, r io.Reader) error {
+	if err := p.validate(); err != nil {
+		return newOtrErrorf("couldn't export encrypted private keys: %v", err)
+	}
+
+	var plain bytes.Buffer
+	if err := exportAccounts(acs, &plain); err != nil {
+		return err
+	}
+	defer wipeBytes(plain.Bytes())
+
+	salt := make([]byte, encryptedKeyFileSaltLen)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return errShortRandomRead
+	}
+
+	aead, err := deriveKeyFileKey(passphrase, salt, p)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(r, nonce); err != nil {
+		return errShortRandomRead
+	}
+
+	f := encryptedKeyFile{
+		KDF: encryptedKeyFileKDFForm{
+			Algorithm: encryptedKeyFileKDF,
+			Salt:      base64.StdEncoding.EncodeToString(salt),
+			Time:      new(big.Int).SetUint64(uint64(p.Time)),
+			Memory:    new(big.Int).SetUint64(uint64(p.Memory)),
+			Threads:   new(big.Int).SetUint64(uint64(p.Threads)),
+		},
+		Cipher: encryptedKeyFileCipher,
+		Nonce:  base64.StdEncoding.EncodeToString(nonce),
+	}
+
+	ad, err := f.associatedData()
+	if err != nil {
+		return err
+	}
+	f.Data = base64.StdEncoding.EncodeToString(aead.Seal(nil, nonce, plain.Bytes(), ad))
+
+	v, err := sexp.MarshalForm(encryptedKeyFileForm, f)
+	if err != nil {
+		return err
+	}
+	return sexp.Encode(w, v)
+}
+
+// ImportEncryptedKeys will read data written by ExportEncryptedKeys, decrypt it using the passphrase
+// and return all accounts defined in it
+func ImportEncryptedKeys(r io.Reader, passphrase []byte) ([]*Account, error) {
+	v, err := sexp.Parse(r)
+	if err != nil {
+		return nil, newOtrErrorf("couldn't import encrypted private keys: %v", err)
+	}
+
+	var f encryptedKeyFile
+	if err := sexp.UnmarshalForm(v, encryptedKeyFileForm, &f); err != nil {
+		return nil, newOtrErrorf("couldn't import encrypted private keys: %v", err)
+	}
+
+	if f.KDF.Algorithm != encryptedKeyFileKDF || f.Cipher != encryptedKeyFileCipher {
+		return nil, newOtrErrorf("couldn't import encrypted private keys: unsupported algorithms %s and %s", f.KDF.Algorithm, f.Cipher)
+	}
+
+	p, err := f.KDF.parameters()
+	if err != nil {
+		return nil, newOtrErrorf("couldn't import encrypted private keys: %v", err)
+	}
+
+	salt, err1 := base64.StdEncoding.DecodeString(f.KDF.Salt)
+	nonce, err2 := base64.StdEncoding.DecodeString(f.Nonce)
+	data, err3 := base64.StdEncoding.DecodeString(f.Data)
+	if firstError(err1, err2, err3) != nil {
+		return nil, newOtrError("couldn't import encrypted private keys: malformed base64 data")
+	}
+
+	aead, err := deriveKeyFileKey(passphrase, salt, p)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errWrongPassphraseOrCorruptKeyFile
+	}
+
+	ad, err := f.associatedData()
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := aead.Open(nil, nonce, data, ad)
+	if err != nil {
+		return nil, errWrongPassphraseOrCorruptKeyFile
+	}
+	defer wipeBytes(plain)
+
+	return ImportKeys(bytes.NewReader(plain))
+}
+
+// ExportEncryptedKeysToFile will create the named file (or truncate it) and write all the accounts to that file encrypted with the passphrase
+func ExportEncryptedKeysToFile(acs []*Account, fname string, passphrase []byte) error {
+	f, err := os.OpenFile(fname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := ExportEncryptedKeys(acs, f, passphrase); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ImportEncryptedKeysFromFile will read the encrypted key file given and return all accounts defined in it
+func ImportEncryptedKeysFromFile(fname string, passphrase []byte) ([]*Account, error) {
+	f, err := os.Open(filepath.Clean(fname))
+	if err != nil {
+		return nil, err
+	}
+
+	res, e := ImportEncryptedKeys(f, passphrase)
+	if e != nil {
+		_ = f.Close()
+		return nil, e
+	}
+
+	return res, f.Close()
+}
+
+// EncryptKeyFile migrates a plain libotr key file to the encrypted format. The encrypted keys are written to a
+// temporary file next to the original, which then replaces it, so the original is left untouched if anything fails.
+func EncryptKeyFile(fname string, passphrase []byte) error {
+	acs, err := ImportKeysFromFile(fname)
+	if err != nil {
+		return err
+	}
+
+	tmp := fname + ".tmp"
+	if err := ExportEncryptedKeysToFile(acs, tmp, passphrase); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, fname)
+}
@@ -0,0 +1,130 @@
+package otr3
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+var fastKeyFileKDFParameters = KeyFileKDFParameters{Time: 1, Memory: 64, Threads: 1}
+
+func fixtureAccountForKeyFile() *Account {
+	priv := &DSAPrivateKey{}
+	priv.Parse(serializedPrivateKey)
+	return &Account{Name: "hello", Protocol: "go-xmpp", Key: priv}
+}
+
+func Test_exportEncryptedAccounts_canBeImportedWithTheSamePassphrase(t *testing.T) {
+	acc := fixtureAccountForKeyFile()
+	b := new(bytes.Buffer)
+	err := exportEncryptedAccounts([]*Account{acc}, b, []byte("secret"), fastKeyFileKDFParameters, rand.Reader)
+	assertNil(t, err)
+
+	res, err := ImportEncryptedKeys(b, []byte("secret"))
+	assertNil(t, err)
+	assertEquals(t, len(res), 1)
+	assertEquals(t, res[0].Name, "hello")
+	assertEquals(t, res[0].Protocol, "go-xmpp")
+	assertDeepEquals(t, res[0].Key, acc.Key)
+}
+
+func Test_exportEncryptedAccounts_doesNotWriteTheKeyInPlaintext(t *testing.T) {
+	acc := fixtureAccountForKeyFile()
+	b := new(bytes.Buffer)
+	_ = exportEncryptedAccounts([]*Account{acc}, b, []byte("secret"), fastKeyFileKDFParameters, rand.Reader)
+
+	out := b.String()
+	assertEquals(t, strings.HasPrefix(out, "(encrypted-privkeys\n  (kdf\n    (algorithm argon2id)\n"), true)
+	assertEquals(t, strings.Contains(out, "hello"), false)
+	assertEquals(t, strings.Contains(out, "private-key"), false)
+}
+
+func Test_exportEncryptedAccounts_returnsAnErrorIfThereIsNotEnoughRandomness(t *testing.T) {
+	err := exportEncryptedAccounts([]*Account{fixtureAccountForKeyFile()}, new(bytes.Buffer), []byte("secret"), fastKeyFileKDFParameters, fixedRand([]string{"ABCD"}))
+	assertEquals(t, err, errShortRandomRead)
+}
+
+func Test_ImportEncryptedKeys_failsWithTheWrongPassphrase(t *testing.T) {
+	b := new(bytes.Buffer)
+	_ = exportEncryptedAccounts([]*Account{fixtureAccountForKeyFile()}, b, []byte("secret"), fastKeyFileKDFParameters, rand.Reader)
+
+	_, err := ImportEncryptedKeys(b, []byte("not the secret"))
+	assertEquals(t, err, errWrongPassphraseOrCorruptKeyFile)
+}
+
+func Test_ImportEncryptedKeys_failsIfTheKDFParametersHaveBeenTamperedWith(t *testing.T) {
+	b := new(bytes.Buffer)
+	_ = exportEncryptedAccounts([]*Account{fixtureAccountForKeyFile()}, b, []byte("secret"), KeyFileKDFParameters{Time: 1, Memory: 64, Threads: 2}, rand.Reader)
+
+	tampered := strings.Replace(b.String(), "(threads #2#)", "(threads #1#)", 1)
+	_, err := ImportEncryptedKeys(strings.NewReader(tampered), []byte("secret"))
+	assertEquals(t, err, errWrongPassphraseOrCorruptKeyFile)
+}
+
+func Test_ImportEncryptedKeys_returnsAnErrorForAPlainKeyFile(t *testing.T) {
+	f, _ := os.Open("test_resources/valid_key.asc")
+	defer f.Close()
+
+	_, err := ImportEncryptedKeys(f, []byte("secret"))
+	assertEquals(t, err, newOtrError("couldn't import encrypted private keys: sexp: expected form encrypted-privkeys"))
+}
+
+func Test_ImportEncryptedKeys_returnsAnErrorForUnsupportedAlgorithms(t *testing.T) {
+	in := `(encrypted-privkeys (kdf (algorithm scrypt)) (cipher aes-256-gcm))`
+	_, err := ImportEncryptedKeys(strings.NewReader(in), []byte("secret"))
+	assertEquals(t, err, newOtrError("couldn't import encrypted private keys: unsupported algorithms scrypt and aes-256-gcm"))
+}
+
+func Test_ImportEncryptedKeys_returnsAnErrorForMissingKDFParameters(t *testing.T) {
+	in := `(encrypted-privkeys (kdf (algorithm argon2id) (time #1#)) (cipher aes-256-gcm))`
+	_, err := ImportEncryptedKeys(strings.NewReader(in), []byte("secret"))
+	assertEquals(t, err, newOtrError("couldn't import encrypted private keys: invalid kdf parameters"))
+}
+
+func Test_ImportEncryptedKeys_returnsAnErrorForTooExpensiveKDFParameters(t *testing.T) {
+	for _, kdf := range []string{
+		"(time #0B#) (memory #100001#) (threads #1#)",
+		"(time #1#) (memory #FFFFFFFF#) (threads #1#)",
+	} {
+		in := `(encrypted-privkeys (kdf (algorithm argon2id) (salt "") ` + kdf + `) (cipher aes-256-gcm))`
+		_, err := ImportEncryptedKeys(strings.NewReader(in), []byte("secret"))
+		assertEquals(t, err, newOtrError("couldn't import encrypted private keys: kdf parameters are too expensive"))
+	}
+}
+
+func Test_exportEncryptedAccounts_returnsAnErrorForTooExpensiveKDFParameters(t *testing.T) {
+	p := KeyFileKDFParameters{Time: 11, Memory: 64, Threads: 1}
+	err := exportEncryptedAccounts([]*Account{fixtureAccountForKeyFile()}, new(bytes.Buffer), []byte("secret"), p, rand.Reader)
+	assertEquals(t, err, newOtrError("couldn't export encrypted private keys: kdf parameters are too expensive"))
+}
+
+func Test_EncryptKeyFile_migratesAPlainKeyFile(t *testing.T) {
+	defer func(p KeyFileKDFParameters) { DefaultKeyFileKDFParameters = p }(DefaultKeyFileKDFParameters)
+	DefaultKeyFileKDFParameters = fastKeyFileKDFParameters
+
+	fname := "test_resources/test_migration_of_keys.blah"
+	defer os.Remove(fname)
+	acc := fixtureAccountForKeyFile()
+	_ = ExportKeysToFile([]*Account{acc}, fname)
+
+	err := EncryptKeyFile(fname, []byte("secret"))
+	assertNil(t, err)
+
+	_, err = ImportKeysFromFile(fname)
+	assertEquals(t, err != nil, true)
+
+	res, err := ImportEncryptedKeysFromFile(fname, []byte("secret"))
+	assertNil(t, err)
+	assertDeepEquals(t, res[0].Key, acc.Key)
+}
+
+func Test_EncryptKeyFile_leavesAnInvalidFileUntouched(t *testing.T) {
+	before, _ := os.ReadFile("test_resources/invalid_key.asc")
+	err := EncryptKeyFile("test_resources/invalid_key.asc", []byte("secret"))
+	after, _ := os.ReadFile("test_resources/invalid_key.asc")
+
+	assertEquals(t, err != nil, true)
+	assertDeepEquals(t, after, before)
+}
@@ -0,0 +1,101 @@
+package otr3
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+const (
+	fingerprintLength    = 20
+	fingerprintGroupSize = 4
+	fingerprintURIScheme = "otr"
+	fingerprintURIParam  = "fp"
+)
+
+var errInvalidFingerprint = newOtrError("invalid fingerprint")
+
+// FormatFingerprint returns the fingerprint in the same human readable form libotr uses,
+// five groups of eight uppercase hex digits separated by spaces, such as "0123ABCD 0123ABCD 0123ABCD 0123ABCD 0123ABCD"
+func FormatFingerprint(fp []byte) string {
+	groups := make([]string, 0, (len(fp)+fingerprintGroupSize-1)/fingerprintGroupSize)
+	for len(fp) > 0 {
+		l := fingerprintGroupSize
+		if len(fp) < l {
+			l = len(fp)
+		}
+		groups = append(groups, strings.ToUpper(hex.EncodeToString(fp[:l])))
+		fp = fp[l:]
+	}
+	return strings.Join(groups, " ")
+}
+
+// ParseFingerprint reads a fingerprint written in hex, ignoring case and any whitespace, so that it accepts
+// the output of FormatFingerprint as well as fingerprints copied from other places
+func ParseFingerprint(s string) ([]byte, error) {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+
+	fp, err := hex.DecodeString(s)
+	if err != nil || len(fp) != fingerprintLength {
+		return nil, errInvalidFingerprint
+	}
+	return fp, nil
+}
+
+// MatchesFingerprint returns true if the human readable fingerprint given, in any form ParseFingerprint accepts,
+// is the fingerprint of the public key
+func MatchesFingerprint(key PublicKey, s string) bool {
+	fp, err := ParseFingerprint(s)
+	return err == nil && subtle.ConstantTimeCompare(fp, key.Fingerprint()) == 1
+}
+
+// FingerprintWords returns the fingerprint as words from the PGP word list, which are easier to read aloud
+// when comparing fingerprints over the phone
+func FingerprintWords(fp []byte) []string {
+	result := make([]string, len(fp))
+	for i, b := range fp {
+		if i%2 == 0 {
+			result[i] = pgpWordsEven[b]
+		} else {
+			result[i] = pgpWordsOdd[b]
+		}
+	}
+	return result
+}
+
+// FingerprintURI returns a URI identifying the account and its fingerprint, such as otr:alice@example.com?fp=0123abcd...
+// It is meant to be encoded as a QR code, so that a peer can scan it to verify the fingerprint out of band.
+func FingerprintURI(account string, fp []byte) string {
+	u := url.URL{
+		Scheme:   fingerprintURIScheme,
+		Opaque:   url.PathEscape(account),
+		RawQuery: fingerprintURIParam + "=" + hex.EncodeToString(fp),
+	}
+	return u.String()
+}
+
+// ParseFingerprintURI reads a URI generated by FingerprintURI, and returns the account and fingerprint in it
+func ParseFingerprintURI(uri string) (account string, fp []byte, err error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != fingerprintURIScheme || u.Opaque == "" {
+		return "", nil, newOtrError("invalid fingerprint URI")
+	}
+
+	account, err = url.PathUnescape(u.Opaque)
+	if err != nil {
+		return "", nil, newOtrError("invalid fingerprint URI")
+	}
+
+	fp, err = ParseFingerprint(u.Query().Get(fingerprintURIParam))
+	if err != nil {
+		return "", nil, err
+	}
+	return account, fp, nil
+}
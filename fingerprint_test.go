@@ -0,0 +1,105 @@
+package otr3
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func fixtureFingerprint() []byte {
+	pub := &DSAPublicKey{}
+	pub.Parse(serializedPublicKey)
+	return pub.Fingerprint()
+}
+
+func Test_FormatFingerprint_writesFiveGroupsOfEightHexDigits(t *testing.T) {
+	fp := fixtureFingerprint()
+	res := FormatFingerprint(fp)
+
+	groups := strings.Split(res, " ")
+	assertEquals(t, len(groups), 5)
+	for _, g := range groups {
+		assertEquals(t, len(g), 8)
+	}
+	assertEquals(t, strings.Join(groups, ""), strings.ToUpper(hex.EncodeToString(fp)))
+}
+
+func Test_FormatFingerprint_formatsAKnownFingerprint(t *testing.T) {
+	fp := bytesFromHex("0102030405060708090a0b0c0d0e0f10111213ff")
+	assertEquals(t, FormatFingerprint(fp), "01020304 05060708 090A0B0C 0D0E0F10 111213FF")
+}
+
+func Test_ParseFingerprint_readsTheFormattedFingerprint(t *testing.T) {
+	fp := fixtureFingerprint()
+	res, err := ParseFingerprint(FormatFingerprint(fp))
+	assertNil(t, err)
+	assertDeepEquals(t, res, fp)
+}
+
+func Test_ParseFingerprint_ignoresCaseAndWhitespace(t *testing.T) {
+	res, err := ParseFingerprint(" 01020304 05060708\n090a0b0c\t0d0E0f10 111213Ff ")
+	assertNil(t, err)
+	assertDeepEquals(t, res, bytesFromHex("0102030405060708090a0b0c0d0e0f10111213ff"))
+}
+
+func Test_ParseFingerprint_returnsAnErrorForInvalidFingerprints(t *testing.T) {
+	for _, s := range []string{"", "01020304", "0102030405060708090a0b0c0d0e0f10111213zz", "0102030405060708090a0b0c0d0e0f10111213ff00"} {
+		_, err := ParseFingerprint(s)
+		assertEquals(t, err, errInvalidFingerprint)
+	}
+}
+
+func Test_MatchesFingerprint_comparesAHumanReadableFingerprintWithAKey(t *testing.T) {
+	pub := &DSAPublicKey{}
+	pub.Parse(serializedPublicKey)
+
+	assertEquals(t, MatchesFingerprint(pub, strings.ToLower(FormatFingerprint(pub.Fingerprint()))), true)
+	assertEquals(t, MatchesFingerprint(pub, FormatFingerprint(alicePrivateKey.PublicKey().Fingerprint())), false)
+	assertEquals(t, MatchesFingerprint(pub, "not a fingerprint"), false)
+}
+
+func Test_FingerprintWords_alternatesBetweenTheTwoWordLists(t *testing.T) {
+	res := FingerprintWords([]byte{0x00, 0x00, 0xFF, 0xFF})
+	assertDeepEquals(t, res, []string{"aardvark", "adroitness", "Zulu", "Yucatan"})
+}
+
+func Test_FingerprintWords_matchesTheExampleFromThePGPWordListDescription(t *testing.T) {
+	fp, _ := ParseFingerprint("E58294F2 E9A22748 6E8B061B 31CC528F D7FA3F19")
+	res := strings.Join(FingerprintWords(fp), " ")
+	assertEquals(t, res, "topmost Istanbul Pluto vagabond treadmill Pacific brackish dictator goldfish Medusa "+
+		"afflict bravado chatter revolver Dupont midsummer stopwatch whimsical cowbell bottomless")
+}
+
+func Test_FingerprintWords_returnsOneWordPerByte(t *testing.T) {
+	assertEquals(t, len(FingerprintWords(fixtureFingerprint())), 20)
+}
+
+func Test_FingerprintURI_canBeParsedBack(t *testing.T) {
+	fp := fixtureFingerprint()
+	uri := FingerprintURI("alice@example.com", fp)
+	assertEquals(t, uri, "otr:alice@example.com?fp="+hex.EncodeToString(fp))
+
+	account, res, err := ParseFingerprintURI(uri)
+	assertNil(t, err)
+	assertEquals(t, account, "alice@example.com")
+	assertDeepEquals(t, res, fp)
+}
+
+func Test_FingerprintURI_escapesTheAccount(t *testing.T) {
+	fp := fixtureFingerprint()
+	uri := FingerprintURI("alice smith?@example.com", fp)
+
+	account, _, err := ParseFingerprintURI(uri)
+	assertNil(t, err)
+	assertEquals(t, account, "alice smith?@example.com")
+}
+
+func Test_ParseFingerprintURI_returnsAnErrorForOtherURIs(t *testing.T) {
+	for _, s := range []string{"http://example.com", "otr:?fp=00", "::"} {
+		_, _, err := ParseFingerprintURI(s)
+		assertEquals(t, err, newOtrError("invalid fingerprint URI"))
+	}
+
+	_, _, err := ParseFingerprintURI("otr:alice@example.com?fp=0102")
+	assertEquals(t, err, errInvalidFingerprint)
+}
@@ -0,0 +1,88 @@
+package otr3
+
+// FragmentPolicy decides which fragments of a message are returned from Send, and which are given to the MessageInjector,
+// in the same way as the OtrlFragmentPolicy of libotr
+type FragmentPolicy int
+
+const (
+	// FragmentSendAll returns all fragments from Send. This is the default.
+	FragmentSendAll FragmentPolicy = iota
+	// FragmentSendAllButFirst gives all fragments except the first to the MessageInjector, and returns the first from Send
+	FragmentSendAllButFirst
+	// FragmentSendAllButLast gives all fragments except the last to the MessageInjector, and returns the last from Send
+	FragmentSendAllButLast
+)
+
+// MessageInjector sends messages to the peer outside of the normal path for outgoing messages
+type MessageInjector interface {
+	// InjectMessage should send the message to the peer right away
+	InjectMessage(msg ValidMessage)
+}
+
+// MaxMessageSizeHandler decides the maximum size of messages, every time a message is fragmented
+type MaxMessageSizeHandler interface {
+	// MaxMessageSize returns the maximum number of bytes a message sent to the peer can have right now,
+	// or zero if there is no limit. It corresponds to the max_message_size operation of libotr.
+	MaxMessageSize() uint16
+}
+
+type dynamicMessageInjector struct {
+	f func(msg ValidMessage)
+}
+
+func (d dynamicMessageInjector) InjectMessage(msg ValidMessage) {
+	d.f(msg)
+}
+
+type dynamicMaxMessageSizeHandler struct {
+	f func() uint16
+}
+
+func (d dynamicMaxMessageSizeHandler) MaxMessageSize() uint16 {
+	return d.f()
+}
+
+// SetFragmentPolicy sets the policy for which fragments of the messages from Send are given to the MessageInjector.
+// The policy is only used when a MessageInjector has been set.
+func (c *Conversation) SetFragmentPolicy(p FragmentPolicy) {
+	c.fragmentPolicy = p
+}
+
+// SetMessageInjector sets the injector used for the fragments the fragment policy doesn't return from Send
+func (c *Conversation) SetMessageInjector(i MessageInjector) {
+	c.messageInjector = i
+}
+
+// SetMaxMessageSizeHandler sets a handler that is asked for the maximum message size every time a message
+// is fragmented, so that the limit can depend on the transport or the peer. It takes precedence over SetFragmentSize.
+func (c *Conversation) SetMaxMessageSizeHandler(h MaxMessageSizeHandler) {
+	c.maxMessageSizeHandler = h
+}
+
+func (c *Conversation) currentFragmentSize() uint16 {
+	if c.maxMessageSizeHandler != nil {
+		return c.maxMessageSizeHandler.MaxMessageSize()
+	}
+	return c.fragmentSize
+}
+
+func (c *Conversation) applyFragmentPolicy(fragments []ValidMessage) []ValidMessage {
+	if c.messageInjector == nil || len(fragments) < 2 {
+		return fragments
+	}
+
+	var toInject, toReturn []ValidMessage
+	switch c.fragmentPolicy {
+	case FragmentSendAllButFirst:
+		toReturn, toInject = fragments[:1], fragments[1:]
+	case FragmentSendAllButLast:
+		toInject, toReturn = fragments[:len(fragments)-1], fragments[len(fragments)-1:]
+	default:
+		return fragments
+	}
+
+	for _, f := range toInject {
+		c.messageInjector.InjectMessage(f)
+	}
+	return toReturn
+}
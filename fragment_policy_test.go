@@ -0,0 +1,101 @@
+package otr3
+
+import (
+	"strings"
+	"testing"
+)
+
+func sendFragmentedMessage(t *testing.T, c *Conversation) (returned, injected []ValidMessage) {
+	c.SetMessageInjector(dynamicMessageInjector{func(m ValidMessage) {
+		injected = append(injected, m)
+	}})
+	returned, err := c.Send(ValidMessage(strings.Repeat("hello world ", 20)))
+	assertNil(t, err)
+	return
+}
+
+func receiveAll(t *testing.T, c *Conversation, msgs ...ValidMessage) MessagePlaintext {
+	var res MessagePlaintext
+	for _, m := range msgs {
+		plain, _, err := c.Receive(m)
+		assertNil(t, err)
+		if plain != nil {
+			res = plain
+		}
+	}
+	return res
+}
+
+func Test_FragmentPolicy_returnsAllFragmentsByDefault(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	alice.SetFragmentSize(100)
+
+	returned, injected := sendFragmentedMessage(t, alice)
+	assertEquals(t, len(returned) > 2, true)
+	assertEquals(t, len(injected), 0)
+	assertEquals(t, string(receiveAll(t, bob, returned...)), strings.Repeat("hello world ", 20))
+}
+
+func Test_FragmentPolicy_sendAllButFirstInjectsTheRest(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	alice.SetFragmentSize(100)
+	alice.SetFragmentPolicy(FragmentSendAllButFirst)
+
+	returned, injected := sendFragmentedMessage(t, alice)
+	assertEquals(t, len(returned), 1)
+	assertEquals(t, len(injected) > 1, true)
+	assertEquals(t, strings.HasPrefix(string(returned[0]), "?OTR|"), true)
+	assertEquals(t, strings.Contains(string(returned[0]), ",00001,"), true)
+
+	all := append(returned, injected...)
+	assertEquals(t, string(receiveAll(t, bob, all...)), strings.Repeat("hello world ", 20))
+}
+
+func Test_FragmentPolicy_sendAllButLastInjectsTheRest(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	alice.SetFragmentSize(100)
+	alice.SetFragmentPolicy(FragmentSendAllButLast)
+
+	returned, injected := sendFragmentedMessage(t, alice)
+	assertEquals(t, len(returned), 1)
+	assertEquals(t, len(injected) > 1, true)
+
+	all := append(injected, returned...)
+	assertEquals(t, string(receiveAll(t, bob, all...)), strings.Repeat("hello world ", 20))
+}
+
+func Test_FragmentPolicy_doesNotInjectUnfragmentedMessages(t *testing.T) {
+	alice, _ := conversationsAfterAKE(t)
+	alice.SetFragmentPolicy(FragmentSendAllButLast)
+
+	returned, injected := sendFragmentedMessage(t, alice)
+	assertEquals(t, len(returned), 1)
+	assertEquals(t, len(injected), 0)
+}
+
+func Test_MaxMessageSizeHandler_isAskedEveryTimeAMessageIsFragmented(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	alice.SetFragmentSize(1000)
+	limits := []uint16{100, 0, 200}
+	var current uint16
+	alice.SetMaxMessageSizeHandler(dynamicMaxMessageSizeHandler{func() uint16 {
+		return current
+	}})
+
+	var counts []int
+	for _, limit := range limits {
+		current = limit
+		msgs, err := alice.Send(ValidMessage(strings.Repeat("hello world ", 20)))
+		assertNil(t, err)
+		for _, m := range msgs {
+			if limit > 0 {
+				assertEquals(t, len(m) <= int(limit), true)
+			}
+		}
+		counts = append(counts, len(msgs))
+		assertEquals(t, string(receiveAll(t, bob, msgs...)), strings.Repeat("hello world ", 20))
+	}
+
+	assertEquals(t, counts[0] > counts[2], true)
+	assertEquals(t, counts[1], 1)
+}
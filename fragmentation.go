@@ -41,6 +41,10 @@ func (c *Conversation) SetFragmentSize(size uint16) {
 }
 
 func (c *Conversation) fragment(data encodedMessage, fraglen uint16) []ValidMessage {
+	if c.binaryTransport {
+		return c.fragmentBinary(data, fraglen)
+	}
+
 	l := len(data)
 
 	if l <= int(fraglen) || fraglen == 0 {
@@ -121,14 +125,18 @@ func (c *Conversation) receiveFragment(beforeCtx fragmentationContext, data Vali
 		return beforeCtx, newOtrError("invalid OTR fragment")
 	}
 
+	return beforeCtx.addFragment(resultData, ix, l), nil
+}
+
+func (ctx fragmentationContext) addFragment(data []byte, ix, l uint16) fragmentationContext {
 	switch {
 	case fragmentIsInvalid(ix, l):
-		return beforeCtx.discardFragment(), nil
+		return ctx.discardFragment()
 	case fragmentIsFirstMessage(ix, l):
-		return restartFragment(resultData, ix, l), nil
-	case fragmentIsNextMessage(beforeCtx, ix, l):
-		return beforeCtx.appendFragment(resultData, ix, l), nil
+		return restartFragment(data, ix, l)
+	case fragmentIsNextMessage(ctx, ix, l):
+		return ctx.appendFragment(data, ix, l)
 	default:
-		return forgetFragment(), nil
+		return forgetFragment()
 	}
 }
@@ -286,3 +286,41 @@ func Test_startingAKE_shouldNotBreakTheEncryptedChannel(t *testing.T) {
 	assertDeepEquals(t, plain, MessagePlaintext(hello))
 	assertNil(t, ret)
 }
+
+func Test_AKE_signalsThatThePeerKeyChangedWhenTheyRestartTheAKEWithAnotherKey(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+
+	var events []SecurityEvent
+	alice.securityEventHandler = dynamicSecurityEventHandler{func(event SecurityEvent) {
+		events = append(events, event)
+	}}
+
+	other := new(DSAPrivateKey)
+	_ = other.Generate(rand.Reader)
+	bob.SetOurKeys([]PrivateKey{other})
+	bob.ourCurrentKey = other
+	allowImmediateNewAKE(bob)
+	completeAKE(t, alice, bob)
+
+	assertDeepEquals(t, events, []SecurityEvent{PeerKeyChanged, StillSecure})
+	assertEquals(t, alice.GetTheirKey().Equal(other.PublicKey()), true)
+}
+
+func Test_AKE_doesNotSignalThatThePeerKeyChangedWhenTheyRestartTheAKEWithTheSameKey(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+
+	var events []SecurityEvent
+	alice.securityEventHandler = dynamicSecurityEventHandler{func(event SecurityEvent) {
+		events = append(events, event)
+	}}
+	allowImmediateNewAKE(bob)
+	completeAKE(t, alice, bob)
+
+	assertDeepEquals(t, events, []SecurityEvent{StillSecure})
+}
+
+// allowImmediateNewAKE makes the conversation answer a query message even if it just finished an AKE
+func allowImmediateNewAKE(c *Conversation) {
+	c.lastMessageStateChange = time.Time{}
+	c.ake.lastStateChange = time.Time{}
+}
@@ -0,0 +1,256 @@
+package otr3
+
+import (
+	"testing"
+)
+
+func fuzzSeedDataMessages() [][]byte {
+	var res [][]byte
+	for _, p := range []plainDataMsg{
+		{message: []byte("hello")},
+		{message: []byte("hello"), tlvs: []tlv{fixtureMessage1().tlv()}},
+		{tlvs: []tlv{{tlvType: tlvTypeDisconnected}}},
+	} {
+		msg, _ := fixtureDataMsg(p)
+		res = append(res, msg)
+	}
+	return res
+}
+
+func fuzzSeedAKEMessages() [][]byte {
+	return [][]byte{
+		fixtureDHCommitMsg(),
+		fixtureDHCommitMsgV2(),
+		fixtureDHKeyMsg(otrV3{}),
+		fixtureDHKeyMsg(otrV2{}),
+		fixtureRevealSigMsg(otrV3{}),
+		fixtureRevealSigMsg(otrV2{}),
+		fixtureSigMsg(otrV3{}),
+		fixtureSigMsg(otrV2{}),
+	}
+}
+
+func FuzzDataMsgDeserialize(f *testing.F) {
+	for _, msg := range fuzzSeedDataMessages() {
+		f.Add(msg[otrv3HeaderLen:])
+	}
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m := dataMsg{}
+		if err := m.deserialize(data, otrV3{}); err != nil {
+			return
+		}
+
+		if len(m.authenticator) != (otrV3{}).hashLength() {
+			t.Errorf("deserialized authenticator has wrong length %d", len(m.authenticator))
+		}
+	})
+}
+
+func FuzzPlainDataMsgDeserialize(f *testing.F) {
+	f.Add([]byte("hello"))
+	f.Add([]byte("hello\x00"))
+	f.Add(plainDataMsg{message: []byte("hello")}.pad().serialize())
+	f.Add(plainDataMsg{tlvs: []tlv{fixtureMessage1Q().tlv(), fixtureMessage2().tlv()}}.serialize())
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p := plainDataMsg{}
+		if err := p.deserialize(makeCopy(data)); err != nil {
+			return
+		}
+
+		if len(p.message) > len(data) {
+			t.Errorf("deserialized message is longer than the input")
+		}
+	})
+}
+
+func FuzzTLVDeserialize(f *testing.F) {
+	f.Add(fixtureMessage1().tlv().serialize())
+	f.Add(fixtureMessage1Q().tlv().serialize())
+	f.Add(fixtureMessage2().tlv().serialize())
+	f.Add(fixtureMessage3().tlv().serialize())
+	f.Add(fixtureMessage4().tlv().serialize())
+	f.Add(fixtureMessageAbort().tlv().serialize())
+	f.Add([]byte{0x00, 0x01, 0x00, 0x00})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		atlv := tlv{}
+		if err := atlv.deserialize(data); err != nil {
+			return
+		}
+
+		if len(atlv.tlvValue) != int(atlv.tlvLength) {
+			t.Errorf("tlv value length %d does not match tlv length %d", len(atlv.tlvValue), atlv.tlvLength)
+		}
+
+		_, _ = atlv.smpMessage()
+	})
+}
+
+func FuzzParseFragment(f *testing.F) {
+	c := newConversation(otrV3{}, fixtureRand())
+	for _, frag := range c.fragment(c.encode(fixtureDHCommitMsg()), 100) {
+		f.Add([]byte(frag[23:]))
+	}
+	f.Add([]byte("00001,00002,abc,"))
+	f.Add([]byte(",,,"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, ix, l, ok := parseFragment(data)
+		if !ok {
+			return
+		}
+
+		_ = fragmentIsInvalid(ix, l)
+	})
+}
+
+func FuzzParseOTRQueryMessage(f *testing.F) {
+	f.Add([]byte("?OTRv23?"))
+	f.Add([]byte("?OTR?v2?"))
+	f.Add([]byte("?OTR?"))
+	f.Add([]byte("?OTRv3? Bob has requested an Off-the-Record private conversation."))
+	f.Add([]byte("?OTR"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, v := range parseOTRQueryMessage(data) {
+			if v < 0 || v > 9 {
+				t.Errorf("parsed impossible version %d", v)
+			}
+		}
+	})
+}
+
+func FuzzExtractWhitespaceTag(f *testing.F) {
+	f.Add([]byte("hello" + string(genWhitespaceTag(policies(allowV2|allowV3)))))
+	f.Add([]byte(string(genWhitespaceTag(policies(allowV3))) + "hello"))
+	f.Add(whitespaceTagHeader)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// extractWhitespaceTag is only called once guessMessageType has found the tag header
+		if guessMessageType(data) != msgGuessTaggedPlaintext {
+			return
+		}
+
+		plain, versions := extractWhitespaceTag(data)
+		if len(plain) > len(data) {
+			t.Errorf("extracted plain text is longer than the input")
+		}
+
+		if versions&^(1<<2|1<<3) != 0 {
+			t.Errorf("extracted unexpected versions %b", versions)
+		}
+	})
+}
+
+func FuzzExtractMPIs(f *testing.F) {
+	f.Add(fixtureMessage2().tlv().tlvValue)
+	f.Add(AppendMPIs(AppendWord(nil, 2), fixedGX(), fixedGY()))
+	f.Add([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		rest, mpis, ok := ExtractMPIs(data)
+		if !ok {
+			return
+		}
+
+		if len(rest) > len(data) || len(mpis)*4 > len(data) {
+			t.Errorf("extracted more MPIs than the input could hold")
+		}
+	})
+}
+
+type fuzzConversationState struct {
+	name string
+	make func() *Conversation
+}
+
+func fuzzEncryptedConversation() *Conversation {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.Policies = policies(allowV2 | allowV3)
+	c.ourCurrentKey = bobPrivateKey
+	c.theirKey = alicePrivateKey.PublicKey()
+	return c
+}
+
+func fuzzConversationStates() []fuzzConversationState {
+	return []fuzzConversationState{
+		{"AUTHSTATE_NONE", func() *Conversation {
+			c := newConversation(otrV3{}, fixtureRand())
+			c.Policies = policies(allowV2 | allowV3 | whitespaceStartAKE | errorStartAKE)
+			c.ourCurrentKey = bobPrivateKey
+			return c
+		}},
+		{"AUTHSTATE_AWAITING_DHKEY", bobContextAtAwaitingDHKey},
+		{"AUTHSTATE_AWAITING_REVEALSIG", aliceContextAtAwaitingRevealSig},
+		{"AUTHSTATE_AWAITING_SIG", bobContextAtAwaitingSig},
+		{"SMPSTATE_EXPECT1", fuzzEncryptedConversation},
+		{"SMPSTATE_EXPECT2", func() *Conversation {
+			c := fuzzEncryptedConversation()
+			c.smp.state = smpStateExpect2{}
+			c.smp.s1 = fixtureSmp1()
+			c.smp.secret = fixtureSecret()
+			return c
+		}},
+		{"SMPSTATE_EXPECT3", func() *Conversation {
+			c := fuzzEncryptedConversation()
+			c.smp.state = smpStateExpect3{}
+			c.smp.s2 = fixtureSmp2()
+			c.smp.secret = fixtureSecret()
+			return c
+		}},
+		{"SMPSTATE_EXPECT4", func() *Conversation {
+			c := fuzzEncryptedConversation()
+			c.smp.state = smpStateExpect4{}
+			c.smp.s1 = fixtureSmp1()
+			c.smp.s3 = fixtureSmp3()
+			c.smp.secret = fixtureSecret()
+			return c
+		}},
+		{"SMPSTATE_WAITINGFORSECRET", func() *Conversation {
+			c := fuzzEncryptedConversation()
+			c.smp.state = smpStateWaitingForSecret{msg: fixtureMessage1()}
+			return c
+		}},
+		{"MSGSTATE_FINISHED", func() *Conversation {
+			c := fuzzEncryptedConversation()
+			c.msgState = finished
+			return c
+		}},
+	}
+}
+
+func FuzzConversationReceive(f *testing.F) {
+	c := newConversation(otrV3{}, fixtureRand())
+	var seeds [][]byte
+	for _, m := range append(fuzzSeedAKEMessages(), fuzzSeedDataMessages()...) {
+		seeds = append(seeds, c.encode(m))
+	}
+	for _, frag := range c.fragment(c.encode(fixtureDHCommitMsg()), 100) {
+		seeds = append(seeds, frag)
+	}
+	seeds = append(seeds,
+		[]byte("?OTRv23?"),
+		[]byte("?OTR Error: something went wrong"),
+		[]byte("hello"+string(genWhitespaceTag(policies(allowV2|allowV3)))),
+		[]byte("hello"),
+	)
+
+	states := fuzzConversationStates()
+	for ix := range states {
+		for _, s := range seeds {
+			f.Add(uint8(ix), s)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, state uint8, data []byte) {
+		st := states[int(state)%len(states)]
+		conv := st.make()
+		_, _, _ = conv.Receive(data)
+		// A second receive exercises whatever state the first message left us in
+		_, _, _ = conv.Receive(data)
+	})
+}
@@ -7,7 +7,9 @@ toolchain go1.23.12
 require (
 	github.com/awnumar/memcall v0.5.0
 	github.com/coyim/constbn v0.0.0-20251201142907-b19b950d1e1c
+	golang.org/x/crypto v0.41.0
 	golang.org/x/sys v0.35.0
+	golang.org/x/text v0.28.0
 )
 
 require (
@@ -18,9 +20,9 @@ require (
 	github.com/securego/gosec/v2 v2.15.0 // indirect
 	github.com/xo/terminfo v0.0.0-20210125001918-ca9a967f8778 // indirect
 	golang.org/x/lint v0.0.0-20241112194109-818c5a804067 // indirect
-	golang.org/x/mod v0.25.0 // indirect
-	golang.org/x/sync v0.15.0 // indirect
-	golang.org/x/tools v0.34.0 // indirect
+	golang.org/x/mod v0.26.0 // indirect
+	golang.org/x/sync v0.16.0 // indirect
+	golang.org/x/tools v0.35.0 // indirect
 	golang.org/x/tools/cmd/cover v0.1.0-deprecated // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
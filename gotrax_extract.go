@@ -100,7 +100,8 @@ func ExtractMPI(d []byte) (newPoint []byte, mpi *big.Int, ok bool) {
 // Data is expected to be in big-endian format
 func ExtractMPIs(d []byte) ([]byte, []*big.Int, bool) {
 	current, mpiCount, ok := ExtractWord(d)
-	if !ok {
+	// every MPI needs at least four bytes for its length
+	if !ok || int64(mpiCount) > int64(len(current)/4) {
 		return nil, nil, false
 	}
 	result := make([]*big.Int, int(mpiCount))
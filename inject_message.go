@@ -12,6 +12,7 @@ func (c *Conversation) injectMessage(vm ValidMessage) {
 }
 
 func (c *Conversation) withInjects(vms []ValidMessage) []ValidMessage {
+	c.collectSMPStep()
 	msgs := c.injections.messages
 	c.injections.messages = c.injections.messages[0:0]
 	return append(vms, msgs...)
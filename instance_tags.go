@@ -77,6 +77,8 @@ func ExtractInstanceTags(m []byte) (ours, theirs uint32, ok bool) {
 		}
 
 		return receiverInstanceTag, senderInstanceTag, true
+	} else if isBinaryFrame(m) {
+		return extractBinaryInstanceTags(m)
 	} else {
 		// All other prefixes are for older versions or don't have instance tags
 		return 0, 0, false
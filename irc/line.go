@@ -0,0 +1,117 @@
+// Package irc helps using OTR conversations over IRC. It keeps OTR messages within the IRC line length limit,
+// wraps them in PRIVMSG or NOTICE commands, and protects whitespace tags from servers that strip trailing whitespace.
+package irc
+
+import "strings"
+
+const (
+	// MaxLineLength is the maximum length of an IRC line, including the final CR LF, from RFC 1459
+	MaxLineLength = 512
+
+	// The longest source prefix we expect when we don't know how the server will show us to the peer
+	maxNickLength   = 30
+	maxUserLength   = 10
+	maxHostLength   = 63
+	maxSourceLength = maxNickLength + 1 + maxUserLength + 1 + maxHostLength
+)
+
+// Message is a PRIVMSG or NOTICE line
+type Message struct {
+	// Source is the nick!user@host prefix of the sender, and empty for lines we send
+	Source string
+	// Command is PRIVMSG or NOTICE
+	Command string
+	// Target is the nick or channel the message was sent to
+	Target string
+	// Text is the text of the message
+	Text string
+}
+
+// Nick returns the nick part of the source
+func (m Message) Nick() string {
+	if i := strings.IndexAny(m.Source, "!@"); i >= 0 {
+		return m.Source[:i]
+	}
+	return m.Source
+}
+
+// isChannel returns true if the name is a channel name rather than a nick
+func isChannel(name string) bool {
+	return name != "" && strings.IndexByte("#&+!", name[0]) >= 0
+}
+
+// equalNames compares nicks or channel names the way IRC servers do, with the RFC 1459 case mapping,
+// where the characters []\~ are the upper case versions of {}|^
+func equalNames(a, b string) bool {
+	return toLowerIRC(a) == toLowerIRC(b)
+}
+
+func toLowerIRC(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		case r == '[':
+			return '{'
+		case r == ']':
+			return '}'
+		case r == '\\':
+			return '|'
+		case r == '~':
+			return '^'
+		}
+		return r
+	}, s)
+}
+
+// String returns the message as an IRC line, without the final CR LF
+func (m Message) String() string {
+	line := m.Command + " " + m.Target + " :" + m.Text
+	if m.Source != "" {
+		line = ":" + m.Source + " " + line
+	}
+	return line
+}
+
+// ParseLine parses an IRC line with a PRIVMSG or NOTICE command. It returns false for all other lines.
+func ParseLine(line string) (Message, bool) {
+	var m Message
+	line = strings.TrimRight(line, "\r\n")
+
+	if strings.HasPrefix(line, ":") {
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			return Message{}, false
+		}
+		m.Source, line = line[1:i], line[i+1:]
+	}
+
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 3 {
+		return Message{}, false
+	}
+
+	m.Command = strings.ToUpper(parts[0])
+	if m.Command != "PRIVMSG" && m.Command != "NOTICE" {
+		return Message{}, false
+	}
+
+	m.Target = parts[1]
+	m.Text = strings.TrimPrefix(parts[2], ":")
+	return m, true
+}
+
+// Budget returns how many bytes of text fit in one line with the command to the target, once the server has
+// added the source prefix to it. If the source is empty, room is left for the longest source we expect.
+func Budget(command, target, source string) int {
+	sourceLength := len(source)
+	if source == "" {
+		sourceLength = maxSourceLength
+	}
+
+	overhead := len(":") + sourceLength + len(" ") + len(command) + len(" ") + len(target) + len(" :") + len("\r\n")
+	if overhead >= MaxLineLength {
+		return 0
+	}
+	return MaxLineLength - overhead
+}
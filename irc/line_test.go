@@ -0,0 +1,46 @@
+package irc
+
+import "testing"
+
+func Test_ParseLine_parsesAPrivmsgWithASource(t *testing.T) {
+	m, ok := ParseLine(":alice!al@example.org PRIVMSG bob :hello there :)\r\n")
+	assertEquals(t, ok, true)
+	assertDeepEquals(t, m, Message{Source: "alice!al@example.org", Command: "PRIVMSG", Target: "bob", Text: "hello there :)"})
+	assertEquals(t, m.Nick(), "alice")
+}
+
+func Test_ParseLine_parsesANoticeWithoutASource(t *testing.T) {
+	m, ok := ParseLine("notice #otr :hi")
+	assertEquals(t, ok, true)
+	assertDeepEquals(t, m, Message{Command: "NOTICE", Target: "#otr", Text: "hi"})
+}
+
+func Test_ParseLine_ignoresOtherCommands(t *testing.T) {
+	_, ok := ParseLine(":server.example.org PING :12345")
+	assertEquals(t, ok, false)
+	_, ok = ParseLine(":alice JOIN #otr")
+	assertEquals(t, ok, false)
+	_, ok = ParseLine(":alice")
+	assertEquals(t, ok, false)
+}
+
+func Test_Message_String_roundTrips(t *testing.T) {
+	line := ":alice!al@example.org NOTICE bob :?OTR:AAMD"
+	m, _ := ParseLine(line)
+	assertEquals(t, m.String(), line)
+}
+
+func Test_Budget_leavesRoomForTheWholeRelayedLine(t *testing.T) {
+	source := "alice!al@example.org"
+	b := Budget("PRIVMSG", "bob", source)
+	line := Message{Source: source, Command: "PRIVMSG", Target: "bob", Text: string(make([]byte, b))}.String()
+	assertEquals(t, len(line)+len("\r\n"), MaxLineLength)
+}
+
+func Test_Budget_leavesRoomForTheLongestSourceWhenItIsUnknown(t *testing.T) {
+	assertEquals(t, Budget("PRIVMSG", "bob", ""), MaxLineLength-maxSourceLength-len(": PRIVMSG bob :\r\n"))
+}
+
+func Test_Budget_returnsZeroForAnImpossibleTarget(t *testing.T) {
+	assertEquals(t, Budget("PRIVMSG", string(make([]byte, 600)), ""), 0)
+}
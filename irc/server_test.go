@@ -0,0 +1,75 @@
+package irc
+
+import (
+	"errors"
+	"strings"
+)
+
+// lineServer simulates the parts of an IRC server that matter for relaying messages between clients
+type lineServer struct {
+	clients                 map[string]*lineClient
+	stripTrailingWhitespace bool
+}
+
+type lineClient struct {
+	nick, user, host string
+	inbox            []string
+}
+
+func newLineServer() *lineServer {
+	return &lineServer{clients: make(map[string]*lineClient)}
+}
+
+func (s *lineServer) connect(nick, user, host string) *lineClient {
+	c := &lineClient{nick: nick, user: user, host: host}
+	s.clients[strings.ToLower(nick)] = c
+	return c
+}
+
+func (c *lineClient) source() string {
+	return c.nick + "!" + c.user + "@" + c.host
+}
+
+// submit takes a line from a client, and relays it to the target with the source prefix,
+// truncating it to the maximum line length like servers do
+func (s *lineServer) submit(from *lineClient, line string) error {
+	if len(line)+len("\r\n") > MaxLineLength {
+		return errors.New("line too long")
+	}
+
+	if strings.ContainsAny(line, "\r\n\x00") {
+		return errors.New("invalid characters in line")
+	}
+
+	m, ok := ParseLine(line)
+	if !ok {
+		return errors.New("unknown command")
+	}
+
+	if s.stripTrailingWhitespace {
+		m.Text = strings.TrimRight(m.Text, " \t")
+	}
+
+	if m.Text == "" {
+		return errors.New("no text to send")
+	}
+
+	to, ok := s.clients[strings.ToLower(m.Target)]
+	if !ok {
+		return errors.New("no such nick")
+	}
+
+	m.Source = from.source()
+	relayed := m.String()
+	if len(relayed) > MaxLineLength-len("\r\n") {
+		relayed = relayed[:MaxLineLength-len("\r\n")]
+	}
+	to.inbox = append(to.inbox, relayed+"\r\n")
+	return nil
+}
+
+func (c *lineClient) takeInbox() []string {
+	res := c.inbox
+	c.inbox = nil
+	return res
+}
@@ -0,0 +1,185 @@
+package irc
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/coyim/otr3"
+)
+
+// whitespaceTagHeader is the start of an OTR whitespace tag, as given by the OTR specification
+const whitespaceTagHeader = " \t  \t\t\t\t \t \t \t  "
+
+// whitespaceTagVersionLength is the length of the part of the whitespace tag for each protocol version
+const whitespaceTagVersionLength = 8
+
+// minFragmentSize is the smallest fragment size given to the conversation. An OTR version 3 fragment header
+// and its final comma take 36 bytes, so smaller fragments couldn't carry any of the message.
+const minFragmentSize = 64
+
+// Session ties an OTR conversation to a nick or channel on an IRC connection.
+// It sets the maximum message size of the conversation from the IRC line length limit, so the conversation
+// shouldn't be given a fragment size or another MaxMessageSizeHandler.
+type Session struct {
+	conv    *otr3.Conversation
+	target  string
+	source  string
+	nick    string
+	command string
+}
+
+// NewSession creates a session sending messages to the target with PRIVMSG
+func NewSession(conv *otr3.Conversation, target string) *Session {
+	s := &Session{
+		conv:    conv,
+		target:  target,
+		command: "PRIVMSG",
+	}
+	conv.SetBinaryTransport(false)
+	conv.SetMaxMessageSizeHandler(s)
+	return s
+}
+
+// SetSource sets our nick!user@host prefix as the server shows it to others. When it is known,
+// more of every line can be used for the message, and fewer fragments are needed.
+func (s *Session) SetSource(source string) {
+	s.source = source
+}
+
+// SetNick sets our own nick. When it is known, only messages the target sends directly to us are given to
+// the conversation. It is taken from the source, if that has been set.
+func (s *Session) SetNick(nick string) {
+	s.nick = nick
+}
+
+func (s *Session) ownNick() string {
+	if s.nick != "" {
+		return s.nick
+	}
+	return Message{Source: s.source}.Nick()
+}
+
+// UseNotice makes the session send messages with NOTICE instead of PRIVMSG, which bots are supposed to use
+func (s *Session) UseNotice(v bool) {
+	if v {
+		s.command = "NOTICE"
+	} else {
+		s.command = "PRIVMSG"
+	}
+}
+
+// MaxMessageSize implements otr3.MaxMessageSizeHandler, so the conversation fragments every message to fit in one line.
+// When the target is so long that almost nothing fits in a line, fragments of minFragmentSize bytes are used anyway,
+// since the conversation doesn't fragment messages at all for smaller sizes.
+func (s *Session) MaxMessageSize() uint16 {
+	switch b := s.budget(); {
+	case b < minFragmentSize:
+		return minFragmentSize
+	case b > math.MaxUint16:
+		return math.MaxUint16
+	default:
+		return uint16(b)
+	}
+}
+
+func (s *Session) budget() int {
+	return Budget(s.command, s.target, s.source)
+}
+
+// Matches returns true if the message was sent to the target channel, or by the target nick to us. Messages the
+// target nick sends to a channel never match, since they aren't part of the private conversation. If our own nick
+// isn't known, messages from the target nick to any nick match.
+func (s *Session) Matches(m Message) bool {
+	if isChannel(s.target) {
+		return equalNames(m.Target, s.target)
+	}
+
+	if !equalNames(m.Nick(), s.target) || isChannel(m.Target) {
+		return false
+	}
+	own := s.ownNick()
+	return own == "" || equalNames(m.Target, own)
+}
+
+// Send gives the text to the conversation, and returns the IRC lines to send, without the final CR LF
+func (s *Session) Send(text string) ([]string, error) {
+	toSend, err := s.conv.Send(otr3.ValidMessage(text))
+	return s.lines(toSend), err
+}
+
+// Receive parses an IRC line and gives the text to the conversation if the line is a message from the target.
+// It returns the plain text of the message and the IRC lines to send back, without the final CR LF.
+// Lines that aren't for the session are ignored.
+func (s *Session) Receive(line string) (plain string, toSend []string, err error) {
+	m, ok := ParseLine(line)
+	if !ok || !s.Matches(m) {
+		return "", nil, nil
+	}
+
+	p, msgs, err := s.conv.Receive(otr3.ValidMessage(m.Text))
+	return string(p), s.lines(msgs), err
+}
+
+func (s *Session) lines(msgs []otr3.ValidMessage) []string {
+	var result []string
+	for _, m := range msgs {
+		if strings.HasPrefix(string(m), "?OTR") {
+			result = append(result, s.line(string(m)))
+			continue
+		}
+
+		for _, text := range splitPlaintext(moveWhitespaceTagToFront(string(m)), s.budget()) {
+			result = append(result, s.line(text))
+		}
+	}
+	return result
+}
+
+func (s *Session) line(text string) string {
+	return Message{Command: s.command, Target: s.target, Text: text}.String()
+}
+
+// moveWhitespaceTagToFront moves the whitespace tag from the end of the text to the start of it, since the specification
+// allows it to be anywhere, and many servers and bouncers remove whitespace at the end of lines
+func moveWhitespaceTagToFront(text string) string {
+	start := strings.Index(text, whitespaceTagHeader)
+	if start < 0 {
+		return text
+	}
+
+	end := start + len(whitespaceTagHeader)
+	for end+whitespaceTagVersionLength <= len(text) && strings.Trim(text[end:end+whitespaceTagVersionLength], " \t") == "" {
+		end += whitespaceTagVersionLength
+	}
+
+	return text[start:end] + text[:start] + text[end:]
+}
+
+// splitPlaintext splits the text at line breaks, which can't be sent in an IRC line, removes NUL bytes, which
+// servers don't accept, and splits lines that don't fit within the budget, without splitting UTF-8 characters
+func splitPlaintext(text string, budget int) []string {
+	text = strings.Replace(text, "\x00", "", -1)
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	text = strings.Replace(text, "\r", "\n", -1)
+
+	var result []string
+	for _, line := range strings.Split(text, "\n") {
+		for len(line) > budget && budget > 0 {
+			end := budget
+			for end > 0 && !utf8.RuneStart(line[end]) {
+				end--
+			}
+			if end == 0 {
+				end = budget
+			}
+			result = append(result, line[:end])
+			line = line[end:]
+		}
+
+		if line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
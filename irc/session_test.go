@@ -0,0 +1,231 @@
+package irc
+
+import (
+	"crypto/rand"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/coyim/otr3"
+)
+
+var (
+	testKeysOnce sync.Once
+	testKeys     [2]otr3.PrivateKey
+)
+
+func testConversation(t *testing.T, i int) *otr3.Conversation {
+	testKeysOnce.Do(func() {
+		for j := range testKeys {
+			keys, err := otr3.GenerateMissingKeys(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			testKeys[j] = keys[0]
+		}
+	})
+
+	c := &otr3.Conversation{Rand: rand.Reader}
+	c.SetOurKeys([]otr3.PrivateKey{testKeys[i]})
+	c.Policies.AllowV2()
+	c.Policies.AllowV3()
+	return c
+}
+
+type ircPeer struct {
+	client   *lineClient
+	session  *Session
+	received []string
+}
+
+type ircFixture struct {
+	server     *lineServer
+	alice, bob *ircPeer
+}
+
+func newIRCFixture(t *testing.T) *ircFixture {
+	s := newLineServer()
+	f := &ircFixture{
+		server: s,
+		alice:  &ircPeer{client: s.connect("alice", "al", "alice.example.org")},
+		bob:    &ircPeer{client: s.connect("bob", "bobby", "a-rather-long-hostname.dynamic.example.org")},
+	}
+	f.alice.session = NewSession(testConversation(t, 0), "bob")
+	f.bob.session = NewSession(testConversation(t, 1), "alice")
+	return f
+}
+
+func (f *ircFixture) submit(t *testing.T, from *ircPeer, lines []string) {
+	for _, l := range lines {
+		if err := f.server.submit(from.client, l); err != nil {
+			t.Fatalf("server rejected %q: %v", l, err)
+		}
+	}
+}
+
+// run delivers lines between the peers until there are none left
+func (f *ircFixture) run(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		delivered := false
+		for _, p := range []*ircPeer{f.alice, f.bob} {
+			for _, line := range p.client.takeInbox() {
+				delivered = true
+				plain, toSend, err := p.session.Receive(line)
+				if err != nil {
+					t.Fatalf("receiving %q: %v", line, err)
+				}
+				if plain != "" {
+					p.received = append(p.received, plain)
+				}
+				f.submit(t, p, toSend)
+			}
+		}
+		if !delivered {
+			return
+		}
+	}
+	t.Fatal("peers never stopped sending")
+}
+
+func (f *ircFixture) startAKE(t *testing.T) {
+	f.submit(t, f.alice, f.alice.session.lines([]otr3.ValidMessage{f.alice.session.conv.QueryMessage()}))
+	f.run(t)
+	assertEquals(t, f.alice.session.conv.IsEncrypted(), true)
+	assertEquals(t, f.bob.session.conv.IsEncrypted(), true)
+}
+
+func Test_Session_fragmentsMessagesToFitInIRCLines(t *testing.T) {
+	f := newIRCFixture(t)
+	f.startAKE(t)
+
+	message := strings.Repeat("All work and no play makes Jack a dull boy. ", 50)
+	lines, err := f.bob.session.Send(message)
+	assertEquals(t, err, nil)
+	assertEquals(t, len(lines) > 1, true)
+	for _, l := range lines {
+		assertEquals(t, strings.HasPrefix(l, "PRIVMSG alice :?OTR|"), true)
+	}
+
+	f.submit(t, f.bob, lines)
+	f.run(t)
+	assertDeepEquals(t, f.alice.received, []string{message})
+}
+
+func Test_Session_usesTheWholeLineWhenTheSourceIsKnown(t *testing.T) {
+	f := newIRCFixture(t)
+	f.startAKE(t)
+	message := strings.Repeat("x", 3000)
+
+	unknown, _ := f.bob.session.Send(message)
+	f.bob.session.SetSource(f.bob.client.source())
+	known, _ := f.bob.session.Send(message)
+
+	assertEquals(t, len(known) < len(unknown), true)
+	f.submit(t, f.bob, known)
+	f.run(t)
+	assertDeepEquals(t, f.alice.received, []string{message})
+}
+
+func Test_Session_canSendWithNotice(t *testing.T) {
+	f := newIRCFixture(t)
+	f.alice.session.UseNotice(true)
+	f.bob.session.UseNotice(true)
+	f.startAKE(t)
+
+	lines, _ := f.alice.session.Send("hello")
+	for _, l := range lines {
+		assertEquals(t, strings.HasPrefix(l, "NOTICE bob :?OTR"), true)
+	}
+	f.submit(t, f.alice, lines)
+	f.run(t)
+	assertDeepEquals(t, f.bob.received, []string{"hello"})
+}
+
+func Test_Session_keepsWhitespaceTagsWhenTheServerStripsTrailingWhitespace(t *testing.T) {
+	f := newIRCFixture(t)
+	f.server.stripTrailingWhitespace = true
+	f.alice.session.conv.Policies.SendWhitespaceTag()
+	f.bob.session.conv.Policies.WhitespaceStartAKE()
+
+	lines, err := f.alice.session.Send("hello bob")
+	assertEquals(t, err, nil)
+	f.submit(t, f.alice, lines)
+	f.run(t)
+
+	assertDeepEquals(t, f.bob.received, []string{"hello bob"})
+	assertEquals(t, f.alice.session.conv.IsEncrypted(), true)
+	assertEquals(t, f.bob.session.conv.IsEncrypted(), true)
+}
+
+func Test_Session_ignoresLinesFromOthers(t *testing.T) {
+	f := newIRCFixture(t)
+	plain, toSend, err := f.alice.session.Receive(":carol!c@example.org PRIVMSG alice :?OTRv3?")
+	assertEquals(t, plain, "")
+	assertEquals(t, len(toSend), 0)
+	assertEquals(t, err, nil)
+
+	plain, _, _ = f.alice.session.Receive(":bob!b@example.org PRIVMSG alice :hi alice")
+	assertEquals(t, plain, "hi alice")
+}
+
+func Test_Session_ignoresMessagesTheTargetSendsToAChannel(t *testing.T) {
+	f := newIRCFixture(t)
+	plain, toSend, err := f.alice.session.Receive(":bob!b@example.org PRIVMSG #otr :?OTRv3?")
+	assertEquals(t, plain, "")
+	assertEquals(t, len(toSend), 0)
+	assertEquals(t, err, nil)
+}
+
+func Test_Session_onlyMatchesMessagesToOurOwnNickWhenItIsKnown(t *testing.T) {
+	s := NewSession(testConversation(t, 0), "bob[m]")
+	s.SetNick("alice")
+
+	assertEquals(t, s.Matches(Message{Source: "BOB{M}!b@example.org", Target: "Alice", Text: "hi"}), true)
+	assertEquals(t, s.Matches(Message{Source: "bob[m]!b@example.org", Target: "carol", Text: "hi"}), false)
+	assertEquals(t, s.Matches(Message{Source: "carol!c@example.org", Target: "alice", Text: "hi"}), false)
+
+	s = NewSession(testConversation(t, 0), "bob")
+	s.SetSource("alice!al@alice.example.org")
+	assertEquals(t, s.Matches(Message{Source: "bob!b@example.org", Target: "carol", Text: "hi"}), false)
+}
+
+func Test_Session_matchesEverythingSentToTheTargetChannel(t *testing.T) {
+	s := NewSession(testConversation(t, 0), "#otr[dev]")
+	s.SetNick("alice")
+
+	assertEquals(t, s.Matches(Message{Source: "carol!c@example.org", Target: "#OTR{DEV}", Text: "hi"}), true)
+	assertEquals(t, s.Matches(Message{Source: "carol!c@example.org", Target: "alice", Text: "hi"}), false)
+	assertEquals(t, s.Matches(Message{Source: "carol!c@example.org", Target: "#other", Text: "hi"}), false)
+}
+
+func Test_Session_splitsPlaintextThatDoesntFitInALine(t *testing.T) {
+	f := newIRCFixture(t)
+	lines, _ := f.alice.session.Send("first\r\nsecond\x00\n" + strings.Repeat("é", 400))
+
+	assertEquals(t, lines[0], "PRIVMSG bob :first")
+	assertEquals(t, lines[1], "PRIVMSG bob :second")
+	assertEquals(t, len(lines), 2+(800+f.alice.session.budget()-1)/f.alice.session.budget())
+	f.submit(t, f.alice, lines)
+	f.run(t)
+	assertEquals(t, strings.Join(f.bob.received[2:], ""), strings.Repeat("é", 400))
+}
+
+func Test_moveWhitespaceTagToFront_movesTheWholeTag(t *testing.T) {
+	tag := whitespaceTagHeader + "  \t\t  \t " + "  \t\t  \t\t"
+	assertEquals(t, moveWhitespaceTagToFront("hello"+tag), tag+"hello")
+	assertEquals(t, moveWhitespaceTagToFront("hello"+tag+"  x"), tag+"hello  x")
+	assertEquals(t, moveWhitespaceTagToFront("hello"), "hello")
+}
+
+func Test_Session_MaxMessageSize_isTheBudgetOfTheLine(t *testing.T) {
+	s := NewSession(testConversation(t, 0), "bob")
+	assertEquals(t, int(s.MaxMessageSize()), Budget("PRIVMSG", "bob", ""))
+}
+
+func Test_Session_MaxMessageSize_neverGoesBelowAUsableFragmentSize(t *testing.T) {
+	s := NewSession(testConversation(t, 0), "#"+strings.Repeat("c", 400))
+	assertEquals(t, s.MaxMessageSize(), uint16(minFragmentSize))
+
+	s = NewSession(testConversation(t, 0), string(make([]byte, 600)))
+	assertEquals(t, s.MaxMessageSize(), uint16(minFragmentSize))
+}
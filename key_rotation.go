@@ -0,0 +1,116 @@
+package otr3
+
+import (
+	"crypto/dsa"
+	"crypto/sha256"
+	"io"
+)
+
+var keyRotationUsage = []byte("OTR key rotation")
+
+// RotateKey generates a new DSA key with the given parameter sizes to replace the current key of the account.
+// The fingerprint of the current key is recorded in SupersededFingerprints, and the replaced key is returned
+// so that it can be used to announce the new key with AnnounceKeyRotation in sessions that are still using it.
+func (a *Account) RotateKey(rand io.Reader, sizes dsa.ParameterSizes) (PrivateKey, error) {
+	k := new(DSAPrivateKey)
+	if err := k.GenerateWithSizes(rand, sizes); err != nil {
+		return nil, err
+	}
+
+	old := a.Key
+	if old != nil {
+		a.SupersededFingerprints = append(a.SupersededFingerprints, old.PublicKey().Fingerprint())
+	}
+	a.Key = k
+	return old, nil
+}
+
+// IsSuperseded returns true if the given fingerprint belongs to a key this account has rotated away from
+func (a *Account) IsSuperseded(fingerprint []byte) bool {
+	for _, f := range a.SupersededFingerprints {
+		if string(f) == string(fingerprint) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyRotationHash returns the data the new key signs, binding it to the key it replaces and to this session
+func keyRotationHash(ssid [8]byte, oldFingerprint []byte, newKey PublicKey) []byte {
+	h := sha256.New()
+	_, _ = h.Write(keyRotationUsage)
+	_, _ = h.Write(ssid[:])
+	_, _ = h.Write(oldFingerprint)
+	_, _ = h.Write(newKey.serialize())
+	return h.Sum(nil)
+}
+
+// AnnounceKeyRotation returns the messages to send to tell the peer that our long-term key is being replaced by newKey.
+// The announcement is sent over the current encrypted session, which is authenticated with the old key, and is signed
+// by the new key. The peer can then decide to trust the new key based on the trust it has in the old one.
+func (c *Conversation) AnnounceKeyRotation(newKey PrivateKey) ([]ValidMessage, error) {
+	if c.msgState != encrypted || c.ourCurrentKey == nil {
+		return nil, newOtrError("cannot announce a key rotation in current state")
+	}
+
+	pub := newKey.PublicKey()
+	sig, err := newKey.Sign(c.rand(), keyRotationHash(c.ssid, c.ourCurrentKey.PublicKey().Fingerprint(), pub))
+	if err != nil {
+		return nil, err
+	}
+
+	value := append(pub.serialize(), sig...)
+	t := tlv{
+		tlvType:   tlvTypeKeyRotation,
+		tlvLength: uint16(len(value)),
+		tlvValue:  value,
+	}
+
+	toSend, _, err := c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, []tlv{t})
+	return toSend, err
+}
+
+func (c *Conversation) processKeyRotationTLV(t tlv, x dataMessageExtra) (toSend *tlv, err error) {
+	if c.theirKey == nil {
+		return nil, nil
+	}
+
+	rest, ok, newKey := ParsePublicKey(t.tlvValue[:t.tlvLength])
+	if !ok {
+		return nil, newOtrError("corrupt key rotation announcement")
+	}
+
+	rest, ok = newKey.Verify(keyRotationHash(c.ssid, c.theirKey.Fingerprint(), newKey), rest)
+	if !ok || len(rest) != 0 {
+		return nil, newOtrError("invalid signature on key rotation announcement")
+	}
+
+	c.receivedKeyRotation(c.theirKey.Fingerprint(), newKey)
+	return nil, nil
+}
+
+// KeyRotationHandler is an interface that will be invoked when the peer announces a replacement for its long-term key
+type KeyRotationHandler interface {
+	// ReceivedKeyRotation will be called with the fingerprint of the key the peer is using in this session, and the new
+	// key that replaces it. The announcement has been verified to come from this session and to be signed by the new key.
+	ReceivedKeyRotation(oldFingerprint []byte, newKey PublicKey)
+}
+
+type dynamicKeyRotationHandler struct {
+	eh func(oldFingerprint []byte, newKey PublicKey)
+}
+
+func (d dynamicKeyRotationHandler) ReceivedKeyRotation(oldFingerprint []byte, newKey PublicKey) {
+	d.eh(oldFingerprint, newKey)
+}
+
+func (c *Conversation) receivedKeyRotation(oldFingerprint []byte, newKey PublicKey) {
+	if c.keyRotationHandler != nil {
+		c.keyRotationHandler.ReceivedKeyRotation(oldFingerprint, newKey)
+	}
+}
+
+// SetKeyRotationHandler will set the handler for what is to happen when the peer announces a new long-term key
+func (c *Conversation) SetKeyRotationHandler(handler KeyRotationHandler) {
+	c.keyRotationHandler = handler
+}
@@ -0,0 +1,153 @@
+package otr3
+
+import (
+	"bytes"
+	"crypto/dsa"
+	"crypto/rand"
+	"sync"
+	"testing"
+)
+
+var (
+	largeDSAKeyOnce sync.Once
+	largeDSAKey     *DSAPrivateKey
+)
+
+// fixtureLargeDSAKey generates a 2048 bit key once, since generating the parameters is slow
+func fixtureLargeDSAKey() *DSAPrivateKey {
+	largeDSAKeyOnce.Do(func() {
+		largeDSAKey = new(DSAPrivateKey)
+		_ = largeDSAKey.GenerateWithSizes(rand.Reader, dsa.L2048N256)
+	})
+	return largeDSAKey
+}
+
+func Test_DSAPrivateKey_GenerateWithSizes_createsKeysWithLargerSignatures(t *testing.T) {
+	k := fixtureLargeDSAKey()
+	assertEquals(t, k.PrivateKey.P.BitLen(), 2048)
+
+	hashed := bytes.Repeat([]byte{0x42}, 32)
+	sig, err := k.Sign(rand.Reader, hashed)
+	assertNil(t, err)
+	assertEquals(t, len(sig), 64)
+
+	rest, ok := k.PublicKey().Verify(hashed, append(sig, 0x01))
+	assertEquals(t, ok, true)
+	assertDeepEquals(t, rest, []byte{0x01})
+}
+
+func Test_DSAPrivateKey_GenerateWithSizes_rejectsUnsupportedSizes(t *testing.T) {
+	k := new(DSAPrivateKey)
+	err := k.GenerateWithSizes(rand.Reader, dsa.L3072N256)
+	assertEquals(t, err, newOtrError("unsupported DSA parameter sizes"))
+}
+
+func Test_DSAPublicKey_Verify_failsForSignaturesShorterThanTwiceQ(t *testing.T) {
+	k := fixtureLargeDSAKey()
+	_, ok := k.PublicKey().Verify(bytes.Repeat([]byte{0x42}, 32), make([]byte, 40))
+	assertEquals(t, ok, false)
+}
+
+func Test_Account_RotateKey_replacesTheKeyAndRecordsTheOldFingerprint(t *testing.T) {
+	priv := &DSAPrivateKey{}
+	priv.Parse(serializedPrivateKey)
+	acc := &Account{Name: "hello", Protocol: "go-xmpp", Key: priv}
+
+	old, err := acc.RotateKey(rand.Reader, dsa.L1024N160)
+	assertNil(t, err)
+	assertEquals(t, old, PrivateKey(priv))
+	assertEquals(t, acc.Key != PrivateKey(priv), true)
+	assertDeepEquals(t, acc.SupersededFingerprints, [][]byte{priv.PublicKey().Fingerprint()})
+	assertEquals(t, acc.IsSuperseded(priv.PublicKey().Fingerprint()), true)
+	assertEquals(t, acc.IsSuperseded(acc.Key.PublicKey().Fingerprint()), false)
+}
+
+func Test_Account_RotateKey_keepsTheOldKeyIfGenerationFails(t *testing.T) {
+	priv := &DSAPrivateKey{}
+	priv.Parse(serializedPrivateKey)
+	acc := &Account{Name: "hello", Protocol: "go-xmpp", Key: priv}
+
+	_, err := acc.RotateKey(fixedRand([]string{}), dsa.L1024N160)
+	assertEquals(t, err != nil, true)
+	assertEquals(t, acc.Key, PrivateKey(priv))
+	assertNil(t, acc.SupersededFingerprints)
+}
+
+func Test_exportAccounts_keepsSupersededFingerprints(t *testing.T) {
+	priv := &DSAPrivateKey{}
+	priv.Parse(serializedPrivateKey)
+	acc := &Account{Name: "hello", Protocol: "go-xmpp", Key: priv, SupersededFingerprints: [][]byte{{0x01, 0xAB}}}
+
+	b := new(bytes.Buffer)
+	_ = exportAccounts([]*Account{acc}, b)
+	res, err := ImportKeys(b)
+	assertNil(t, err)
+	assertDeepEquals(t, res[0].SupersededFingerprints, [][]byte{{0x01, 0xAB}})
+}
+
+func Test_ImportKeys_returnsAnErrorForAMalformedSupersededFingerprint(t *testing.T) {
+	in := `(privkeys (account (name "a") (protocol p) (private-key (dsa (p #01#))) (superseded-fingerprint "xyz")))`
+	_, err := ImportKeys(bytes.NewBufferString(in))
+	assertEquals(t, err, newOtrError(`couldn't import account 1 ("a"): invalid superseded-fingerprint "xyz"`))
+}
+
+func conversationsAfterAKE(t *testing.T) (alice, bob *Conversation) {
+	alice = &Conversation{Rand: rand.Reader}
+	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
+	alice.Policies = policies(allowV3)
+
+	bob = &Conversation{Rand: rand.Reader}
+	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
+	bob.Policies = policies(allowV3)
+
+	completeAKE(t, alice, bob)
+	return
+}
+
+func Test_AnnounceKeyRotation_letsThePeerKnowAboutTheNewKey(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	newKey := fixtureLargeDSAKey()
+
+	var oldFingerprint []byte
+	var announced PublicKey
+	bob.SetKeyRotationHandler(dynamicKeyRotationHandler{func(old []byte, k PublicKey) {
+		oldFingerprint = old
+		announced = k
+	}})
+
+	toSend, err := alice.AnnounceKeyRotation(newKey)
+	assertNil(t, err)
+
+	plain, _, err := bob.Receive(toSend[0])
+	assertNil(t, err)
+	assertNil(t, plain)
+	assertDeepEquals(t, oldFingerprint, alicePrivateKey.PublicKey().Fingerprint())
+	assertDeepEquals(t, announced.Fingerprint(), newKey.PublicKey().Fingerprint())
+}
+
+func Test_AnnounceKeyRotation_returnsAnErrorIfNotEncrypted(t *testing.T) {
+	c := &Conversation{Rand: rand.Reader}
+	_, err := c.AnnounceKeyRotation(bobPrivateKey)
+	assertEquals(t, err, newOtrError("cannot announce a key rotation in current state"))
+}
+
+func Test_processKeyRotationTLV_rejectsAnnouncementsSignedByAnotherKey(t *testing.T) {
+	_, bob := conversationsAfterAKE(t)
+
+	called := false
+	bob.SetKeyRotationHandler(dynamicKeyRotationHandler{func([]byte, PublicKey) { called = true }})
+
+	pub := bobPrivateKey.PublicKey()
+	sig, _ := alicePrivateKey.Sign(rand.Reader, keyRotationHash(bob.ssid, alicePrivateKey.PublicKey().Fingerprint(), pub))
+	value := append(pub.serialize(), sig...)
+
+	_, err := bob.processKeyRotationTLV(tlv{tlvType: tlvTypeKeyRotation, tlvLength: uint16(len(value)), tlvValue: value}, dataMessageExtra{})
+	assertEquals(t, err, newOtrError("invalid signature on key rotation announcement"))
+	assertEquals(t, called, false)
+}
+
+func Test_processKeyRotationTLV_rejectsACorruptKey(t *testing.T) {
+	_, bob := conversationsAfterAKE(t)
+	_, err := bob.processKeyRotationTLV(tlv{tlvType: tlvTypeKeyRotation, tlvLength: 2, tlvValue: []byte{0x00, 0x00}}, dataMessageExtra{})
+	assertEquals(t, err, newOtrError("corrupt key rotation announcement"))
+}
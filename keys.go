@@ -7,7 +7,9 @@ import (
 	"crypto/cipher"
 	"crypto/dsa"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
@@ -38,6 +40,7 @@ type PublicKey interface {
 	serialize() []byte
 
 	IsSame(PublicKey) bool
+	Equal(PublicKey) bool
 }
 
 // PrivateKey is a private key used to sign messages
@@ -91,6 +94,9 @@ type Account struct {
 	Name     string
 	Protocol string
 	Key      PrivateKey
+
+	// SupersededFingerprints lists the fingerprints of the keys this account used before rotating to the current key
+	SupersededFingerprints [][]byte
 }
 
 func readSymbolAndExpect(r *bufio.Reader, s string) bool {
@@ -153,17 +159,22 @@ func ExportKeysToFile(acs []*Account, fname string) error {
 	if err != nil {
 		return err
 	}
-	exportAccounts(acs, f)
+	if err := exportAccounts(acs, f); err != nil {
+		_ = f.Close()
+		return err
+	}
 	return f.Close()
 }
 
-// ImportKeys will read the libotr formatted data given and return all accounts defined in it
+// ImportKeys will read the libotr formatted data given and return all accounts defined in it.
+// If the data is malformed, the error returned will give the line and column of the problem, or say
+// which account and parameter couldn't be imported. Data in the canonical or transport formats of libgcrypt is also accepted.
 func ImportKeys(r io.Reader) ([]*Account, error) {
-	res, ok := readAccounts(bufio.NewReader(r))
-	if !ok {
-		return nil, newOtrError("couldn't import data into private key")
+	v, err := sexp.Parse(r)
+	if err != nil {
+		return nil, newOtrErrorf("couldn't import data into private key: %v", err)
 	}
-	return res, nil
+	return importAccounts(v)
 }
 
 func assignParameter(k *dsa.PrivateKey, s string, v *big.Int) bool {
@@ -286,8 +297,30 @@ func (pub *DSAPublicKey) IsAvailableForVersion(v uint16) bool {
 
 // IsSame returns true if the given public key is a DSA public key that is equal to this key
 func (pub *DSAPublicKey) IsSame(other PublicKey) bool {
-	oth, ok := other.(*DSAPublicKey)
-	return ok && pub == oth
+	return pub.Equal(other)
+}
+
+// Equal returns true if the given public key has the same serialized form, and therefore the same fingerprint, as this key.
+// The comparison takes constant time for keys of the same length.
+func (pub *DSAPublicKey) Equal(other PublicKey) bool {
+	return publicKeysEqual(pub, other)
+}
+
+// publicKeysEqual compares two public keys of any type by value, in constant time for keys of the same length
+func publicKeysEqual(one, two PublicKey) bool {
+	if isNilPublicKey(one) || isNilPublicKey(two) {
+		return false
+	}
+	s1, s2 := one.serialize(), two.serialize()
+	return s1 != nil && s2 != nil && subtle.ConstantTimeCompare(s1, s2) == 1
+}
+
+func isNilPublicKey(k PublicKey) bool {
+	if k == nil {
+		return true
+	}
+	pub, ok := k.(*DSAPublicKey)
+	return ok && pub == nil
 }
 
 // ParsePrivateKey is an algorithm indepedent way of parsing private keys
@@ -407,23 +440,34 @@ func (priv *DSAPrivateKey) Sign(rand io.Reader, hashed []byte) ([]byte, error) {
 		rBytes := r.Bytes()
 		sBytes := s.Bytes()
 
-		out := make([]byte, 40)
-		copy(out[20-len(rBytes):], rBytes)
+		l := priv.DSAPublicKey.signatureComponentLength()
+		out := make([]byte, 2*l)
+		copy(out[l-len(rBytes):], rBytes)
 		copy(out[len(out)-len(sBytes):], sBytes)
 		return out, nil
 	}
 	return nil, err
 }
 
+// signatureComponentLength returns the length in bytes of the r and s values in a signature made with this key.
+// The wire format uses the length of q, which is 20 bytes for the 1024 bit keys libotr uses.
+func (pub *DSAPublicKey) signatureComponentLength() int {
+	if pub.Q == nil {
+		return 20
+	}
+	return (pub.Q.BitLen() + 7) / 8
+}
+
 // Verify will verify a signature of a hashed data using dsa Verify.
 func (pub *DSAPublicKey) Verify(hashed, sig []byte) (nextPoint []byte, sigOk bool) {
-	if len(sig) < 2*20 {
+	l := pub.signatureComponentLength()
+	if len(sig) < 2*l {
 		return nil, false
 	}
-	r := new(big.Int).SetBytes(sig[:20])
-	s := new(big.Int).SetBytes(sig[20:40])
+	r := new(big.Int).SetBytes(sig[:l])
+	s := new(big.Int).SetBytes(sig[l : 2*l])
 	ok := dsa.Verify(&pub.PublicKey, hashed, r, s)
-	return sig[20*2:], ok
+	return sig[l*2:], ok
 }
 
 func counterEncipher(key, iv, src, dst []byte) error {
@@ -501,7 +545,19 @@ func (priv *DSAPrivateKey) Import(in []byte) bool {
 
 // Generate will generate a new DSA Private Key with the randomness provided. The parameter size used is 1024 and 160.
 func (priv *DSAPrivateKey) Generate(rand io.Reader) error {
-	if err := dsa.GenerateParameters(&priv.PrivateKey.PublicKey.Parameters, rand, dsa.L1024N160); err != nil {
+	return priv.GenerateWithSizes(rand, dsa.L1024N160)
+}
+
+// GenerateWithSizes will generate a new DSA Private Key with the given parameter sizes. Apart from the 1024 and 160
+// sizes used by Generate, dsa.L2048N224 and dsa.L2048N256 can be used, since the wire format sizes signatures after q.
+// Be aware that libotr and many other implementations only accept 1024 bit keys.
+func (priv *DSAPrivateKey) GenerateWithSizes(rand io.Reader, sizes dsa.ParameterSizes) error {
+	switch sizes {
+	case dsa.L1024N160, dsa.L2048N224, dsa.L2048N256:
+	default:
+		return newOtrError("unsupported DSA parameter sizes")
+	}
+	if err := dsa.GenerateParameters(&priv.PrivateKey.PublicKey.Parameters, rand, sizes); err != nil {
 		return err
 	}
 	if err := dsa.GenerateKey(&priv.PrivateKey, rand); err != nil {
@@ -527,67 +583,136 @@ func notHex(r rune) bool {
 	return true
 }
 
-func exportName(n string, w *bufio.Writer) {
-	indent := "    "
-	_, _ = w.WriteString(indent)
-	_, _ = w.WriteString("(name \"")
-	_, _ = w.WriteString(n)
-	_, _ = w.WriteString("\")\n")
-}
-
-func exportProtocol(n string, w *bufio.Writer) {
-	indent := "    "
-	_, _ = w.WriteString(indent)
-	_, _ = w.WriteString("(protocol ")
-	_, _ = w.WriteString(n)
-	_, _ = w.WriteString(")\n")
-}
-
-func exportPrivateKey(key PrivateKey, w *bufio.Writer) {
-	indent := "    "
-	_, _ = w.WriteString(indent)
-	_, _ = w.WriteString("(private-key\n")
-	exportDSAPrivateKey(key.(*DSAPrivateKey), w)
-	_, _ = w.WriteString(indent)
-	_, _ = w.WriteString(")\n")
-}
-
-func exportDSAPrivateKey(key *DSAPrivateKey, w *bufio.Writer) {
-	indent := "      "
-	_, _ = w.WriteString(indent)
-	_, _ = w.WriteString("(dsa\n")
-	exportParameter("p", key.PrivateKey.P, w)
-	exportParameter("q", key.PrivateKey.Q, w)
-	exportParameter("g", key.PrivateKey.G, w)
-	exportParameter("y", key.PrivateKey.Y, w)
-	exportParameter("x", key.PrivateKey.X, w)
-	_, _ = w.WriteString(indent)
-	_, _ = w.WriteString(")\n")
-}
-
-func exportParameter(name string, val *big.Int, w *bufio.Writer) {
-	indent := "        "
-	_, _ = w.WriteString(indent)
-	_, _ = w.WriteString(fmt.Sprintf("(%s #%X#)\n", name, val))
-}
-
-func exportAccount(a *Account, w *bufio.Writer) {
-	indent := "  "
-	_, _ = w.WriteString(indent)
-	_, _ = w.WriteString("(account\n")
-	exportName(a.Name, w)
-	exportProtocol(a.Protocol, w)
-	exportPrivateKey(a.Key, w)
-	_, _ = w.WriteString(indent)
-	_, _ = w.WriteString(")\n")
-}
-
-func exportAccounts(as []*Account, w io.Writer) {
-	bw := bufio.NewWriter(w)
-	_, _ = bw.WriteString("(privkeys\n")
+type privateKeyFileAccount struct {
+	Name       string                   `sexp:"name"`
+	Protocol   string                   `sexp:"protocol,symbol"`
+	Key        privateKeyFilePrivateKey `sexp:"private-key"`
+	Superseded []string                 `sexp:"superseded-fingerprint"`
+}
+
+type privateKeyFilePrivateKey struct {
+	DSA *privateKeyFileDSA `sexp:"dsa"`
+}
+
+type privateKeyFileDSA struct {
+	P *big.Int `sexp:"p"`
+	Q *big.Int `sexp:"q"`
+	G *big.Int `sexp:"g"`
+	Y *big.Int `sexp:"y"`
+	X *big.Int `sexp:"x"`
+}
+
+type privateKeyFile struct {
+	Accounts []privateKeyFileAccount `sexp:"account"`
+}
+
+func importAccounts(v sexp.Value) ([]*Account, error) {
+	top, ok := v.(sexp.Cons)
+	if !ok || (top.First() != sexp.Symbol("privkeys") && top.First() != sexp.Octets("privkeys")) {
+		return nil, newOtrError("couldn't import data into private key: expected a privkeys form")
+	}
+
+	var result []*Account
+	rest := top.Second()
+	for {
+		c, ok := rest.(sexp.Cons)
+		if !ok {
+			return result, nil
+		}
+		rest = c.Second()
+
+		var a privateKeyFileAccount
+		err := sexp.UnmarshalForm(c.First(), "account", &a)
+		if err == nil {
+			err = a.validate()
+		}
+		if err != nil {
+			return nil, newOtrErrorf("couldn't import account %d%s: %v", len(result)+1, describeAccountName(a.Name), err)
+		}
+		result = append(result, a.account())
+	}
+}
+
+func describeAccountName(name string) string {
+	if name == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (%q)", name)
+}
+
+func (a privateKeyFileAccount) validate() error {
+	switch {
+	case a.Name == "":
+		return errors.New("missing name")
+	case a.Protocol == "":
+		return errors.New("missing protocol")
+	case a.Key.DSA == nil:
+		return errors.New("missing private-key.dsa")
+	}
+	for _, f := range a.Superseded {
+		if _, err := hex.DecodeString(f); err != nil {
+			return fmt.Errorf("invalid superseded-fingerprint %q", f)
+		}
+	}
+	return nil
+}
+
+func (a privateKeyFileAccount) account() *Account {
+	d := a.Key.DSA
+	k := new(DSAPrivateKey)
+	k.PrivateKey.P = d.P
+	k.PrivateKey.Q = d.Q
+	k.PrivateKey.G = d.G
+	k.PrivateKey.Y = d.Y
+	k.PrivateKey.X = d.X
+	k.DSAPublicKey.PublicKey = k.PrivateKey.PublicKey
+	k.lock()
+
+	res := &Account{Name: a.Name, Protocol: a.Protocol, Key: k}
+	for _, f := range a.Superseded {
+		fp, _ := hex.DecodeString(f)
+		res.SupersededFingerprints = append(res.SupersededFingerprints, fp)
+	}
+	return res
+}
+
+func exportPrivateKey(key PrivateKey) (privateKeyFilePrivateKey, error) {
+	k, ok := key.(*DSAPrivateKey)
+	if !ok {
+		return privateKeyFilePrivateKey{}, newOtrErrorf("can't export private key of type %T", key)
+	}
+	return privateKeyFilePrivateKey{
+		DSA: &privateKeyFileDSA{
+			P: k.PrivateKey.P,
+			Q: k.PrivateKey.Q,
+			G: k.PrivateKey.G,
+			Y: k.PrivateKey.Y,
+			X: k.PrivateKey.X,
+		},
+	}, nil
+}
+
+func exportAccounts(as []*Account, w io.Writer) error {
+	var f privateKeyFile
 	for _, a := range as {
-		exportAccount(a, bw)
+		k, err := exportPrivateKey(a.Key)
+		if err != nil {
+			return err
+		}
+		fa := privateKeyFileAccount{
+			Name:     a.Name,
+			Protocol: a.Protocol,
+			Key:      k,
+		}
+		for _, fp := range a.SupersededFingerprints {
+			fa.Superseded = append(fa.Superseded, hex.EncodeToString(fp))
+		}
+		f.Accounts = append(f.Accounts, fa)
+	}
+
+	v, err := sexp.MarshalForm("privkeys", f)
+	if err != nil {
+		return err
 	}
-	_, _ = bw.WriteString(")\n")
-	_ = bw.Flush()
+	return sexp.Encode(w, v)
 }
@@ -4,9 +4,14 @@ import (
 	"bufio"
 	"bytes"
 	"crypto/rand"
+	"fmt"
+	"math/big"
 	"os"
+	"strings"
 	"syscall"
 	"testing"
+
+	"github.com/coyim/otr3/sexp"
 )
 
 var (
@@ -518,6 +523,135 @@ func Test_readAccounts_willReturnMoreThanOneAccount(t *testing.T) {
 	assertDeepEquals(t, ok, true)
 }
 
+var validDSAKeyForm = dsaKeyForm(validDSAKeyParams())
+
+func dsaKeyForm(params map[string]string) string {
+	form := "(dsa"
+	for _, name := range []string{"p", "q", "g", "y", "x"} {
+		if v, ok := params[name]; ok {
+			form += "\n  (" + name + " " + v + ")"
+		}
+	}
+	return form + ")"
+}
+
+// validDSAKeyParams returns the parameters of a DSA key where y = g^x mod p, written as libotr writes them
+func validDSAKeyParams() map[string]string {
+	return map[string]string{"p": "#00F24843F9447B62138AE49BF83188D1353ADA5CAC118890CFDEC01BF349D75E887B19C221665C7857CAD583AF656C67FB04A99FD8F8D69D09C9529C6C14D426F1E3924DC9243AF2970E3E4B04A23489A09E8A90E7E81EBA763AD4F0636B8A43415B6FC16A02C3624CE76272FA00783C8DB850D3A996B58136F7A0EB80AE0BC613#", "q": "#00D16B2607FCBC0EDC639F763A54F34475B1CC8473#", "g": "#00B15AFEF5F96EFEE41006F136C23A18849DA8133069A879D083F7C7AA362E187DAE3ED0C4F372D0D4E3AAE567008A1872A6E85D8F84E53A3FE1B352AF0B4E2F0CB033A6D34285ECD3E4A93653BDE99C3A8D840D9D35F82AC2FA8539DB6C7F7A1DAD77FEECD62803757FF1E2DE4CEC4A5A2AD643271514DDEEEF3D008F66FBF9DB#", "y": "#01F9BE7DA0E4E84774048058B53202B2704BF688A306092ED533A55E68EABA814C8D62F45AAD8FF30C3055DCA461B7DBA6B78938FC4D69780A830C6457CC107F3D275C21D00E53147C14162176C77169D3BCA586DC30F15F4B482160E276869AA336F38AF7FC3686A764AB5A02C751D921A42B8B9AE8E06918059CD73C424154#", "x": "#00943480B228FC0D3D7ADFC91F680FC415E1306333#"}
+}
+
+func importAccount(name, protocol, key string) ([]*Account, error) {
+	return ImportKeys(strings.NewReader("(privkeys (account\n(name " + name + ")\n(protocol " + protocol + ")\n(private-key " + key + ")))"))
+}
+
+func Test_ImportKeys_willReturnTheDSAParametersRead(t *testing.T) {
+	res, err := importAccount(`"foo"`, "libpurple-Jabber", validDSAKeyForm)
+	assertNil(t, err)
+	k := res[0].Key.(*DSAPrivateKey).PrivateKey
+	assertDeepEquals(t, k.P, bnFromHex("00F24843F9447B62138AE49BF83188D1353ADA5CAC118890CFDEC01BF349D75E887B19C221665C7857CAD583AF656C67FB04A99FD8F8D69D09C9529C6C14D426F1E3924DC9243AF2970E3E4B04A23489A09E8A90E7E81EBA763AD4F0636B8A43415B6FC16A02C3624CE76272FA00783C8DB850D3A996B58136F7A0EB80AE0BC613"))
+	assertDeepEquals(t, k.Q, bnFromHex("00D16B2607FCBC0EDC639F763A54F34475B1CC8473"))
+	assertDeepEquals(t, k.G, bnFromHex("00B15AFEF5F96EFEE41006F136C23A18849DA8133069A879D083F7C7AA362E187DAE3ED0C4F372D0D4E3AAE567008A1872A6E85D8F84E53A3FE1B352AF0B4E2F0CB033A6D34285ECD3E4A93653BDE99C3A8D840D9D35F82AC2FA8539DB6C7F7A1DAD77FEECD62803757FF1E2DE4CEC4A5A2AD643271514DDEEEF3D008F66FBF9DB"))
+	assertDeepEquals(t, k.Y, bnFromHex("01F9BE7DA0E4E84774048058B53202B2704BF688A306092ED533A55E68EABA814C8D62F45AAD8FF30C3055DCA461B7DBA6B78938FC4D69780A830C6457CC107F3D275C21D00E53147C14162176C77169D3BCA586DC30F15F4B482160E276869AA336F38AF7FC3686A764AB5A02C751D921A42B8B9AE8E06918059CD73C424154"))
+	assertDeepEquals(t, k.X, bnFromHex("00943480B228FC0D3D7ADFC91F680FC415E1306333"))
+	assertDeepEquals(t, res[0].Key.PublicKey().(*DSAPublicKey).PublicKey, k.PublicKey)
+}
+
+func Test_ImportKeys_willReturnAnErrorForAnUnknownParameter(t *testing.T) {
+	params := validDSAKeyParams()
+	params["y"] += ")\n  (quux #00FC07ABCF0DC916AFF6E9A0D450A9B7A858#"
+	_, err := importAccount(`"foo"`, "libpurple-Jabber", dsaKeyForm(params))
+	assertDeepEquals(t, err, newOtrError(`couldn't import account 1 ("foo"): sexp: unexpected form quux in account.private-key.dsa`))
+}
+
+func Test_ImportKeys_willReturnAnErrorForAParameterOfTheWrongType(t *testing.T) {
+	params := validDSAKeyParams()
+	params["q"] = `"AB"`
+	_, err := importAccount(`"foo"`, "libpurple-Jabber", dsaKeyForm(params))
+	assertDeepEquals(t, err, newOtrError(`couldn't import account 1 ("foo"): sexp: expected a bignum for account.private-key.dsa.q, got "AB"`))
+}
+
+func Test_ImportKeys_willReturnAnErrorForAnUnknownKeyType(t *testing.T) {
+	_, err := importAccount(`"foo"`, "libpurple-Jabber", "(dsax (p #00FC#))")
+	assertDeepEquals(t, err, newOtrError(`couldn't import account 1 ("foo"): sexp: unexpected form dsax in account.private-key`))
+}
+
+func Test_ImportKeys_willReturnAnErrorForAMissingName(t *testing.T) {
+	in := "(privkeys (account (protocol libpurple-Jabber) (private-key " + validDSAKeyForm + ")))"
+	_, err := ImportKeys(strings.NewReader(in))
+	assertDeepEquals(t, err, newOtrError("couldn't import account 1: missing name"))
+}
+
+func Test_ImportKeys_willReturnAnErrorForAMissingProtocol(t *testing.T) {
+	in := `(privkeys (account (name "foo") (private-key ` + validDSAKeyForm + ")))"
+	_, err := ImportKeys(strings.NewReader(in))
+	assertDeepEquals(t, err, newOtrError(`couldn't import account 1 ("foo"): missing protocol`))
+}
+
+func Test_ImportKeys_willReturnAnErrorForAnIncorrectTagInTheAccount(t *testing.T) {
+	in := `(privkeys (account (namex "foo") (protocol libpurple-Jabber) (private-key ` + validDSAKeyForm + ")))"
+	_, err := ImportKeys(strings.NewReader(in))
+	assertDeepEquals(t, err, newOtrError("couldn't import account 1: sexp: unexpected form namex in account"))
+}
+
+func Test_ImportKeys_willAcceptANameWrittenAsASymbol(t *testing.T) {
+	res, err := importAccount("foo", "libpurple-Jabber", validDSAKeyForm)
+	assertNil(t, err)
+	assertEquals(t, res[0].Name, "foo")
+}
+
+func Test_ImportKeys_willReturnAnErrorForANameOfTheWrongType(t *testing.T) {
+	_, err := importAccount("#42#", "libpurple-Jabber", validDSAKeyForm)
+	assertDeepEquals(t, err, newOtrError("couldn't import account 1: sexp: expected a string or symbol for account.name, got #42#"))
+}
+
+func Test_ImportKeys_willReturnZeroAccountsIfThereAreNone(t *testing.T) {
+	res, err := ImportKeys(strings.NewReader("(privkeys)"))
+	assertNil(t, err)
+	assertEquals(t, len(res), 0)
+}
+
+func Test_ImportKeys_willReturnAnErrorForAnIncorrectPrivkeysTag(t *testing.T) {
+	for _, in := range []string{"privkeys", "(privkeysx)", `("privkeys")`} {
+		_, err := ImportKeys(strings.NewReader(in))
+		assertDeepEquals(t, err, newOtrError("couldn't import data into private key: expected a privkeys form"))
+	}
+}
+
+func Test_ImportKeys_willReturnAnErrorForAnUnfinishedList(t *testing.T) {
+	_, err := ImportKeys(strings.NewReader("(privkeys"))
+	assertDeepEquals(t, err, newOtrError("couldn't import data into private key: sexp: line 1, column 10: expected ')', found end of input"))
+}
+
+func Test_ImportKeys_willReturnAnErrorForAFormThatIsNotAnAccount(t *testing.T) {
+	in := `(privkeys (accountx (name "2") (protocol libpurple-jabber-gtalk) (private-key ` + validDSAKeyForm + ")))"
+	_, err := ImportKeys(strings.NewReader(in))
+	assertDeepEquals(t, err, newOtrError("couldn't import account 1: sexp: expected form account"))
+}
+
+func Test_ImportKeys_willReturnMoreThanOneAccount(t *testing.T) {
+	in := `(privkeys
+(account (name "foo2") (protocol libpurple-Jabberx) (private-key ` + dsaKeyForm(alicePrivateKeyParams()) + `))
+(account (name "2") (protocol libpurple-jabber-gtalk) (private-key ` + validDSAKeyForm + `)))`
+	res, err := ImportKeys(strings.NewReader(in))
+	assertNil(t, err)
+	assertEquals(t, len(res), 2)
+	assertEquals(t, res[0].Name, "foo2")
+	assertEquals(t, res[0].Protocol, "libpurple-Jabberx")
+	assertDeepEquals(t, res[0].Key.(*DSAPrivateKey).PrivateKey, alicePrivateKey.(*DSAPrivateKey).PrivateKey)
+	assertEquals(t, res[1].Name, "2")
+	assertEquals(t, res[1].Protocol, "libpurple-jabber-gtalk")
+	assertDeepEquals(t, res[1].Key.(*DSAPrivateKey).PrivateKey.Q, bnFromHex("00D16B2607FCBC0EDC639F763A54F34475B1CC8473"))
+}
+
+func alicePrivateKeyParams() map[string]string {
+	k := alicePrivateKey.(*DSAPrivateKey).PrivateKey
+	params := map[string]string{}
+	for name, v := range map[string]*big.Int{"p": k.P, "q": k.Q, "g": k.G, "y": k.Y, "x": k.X} {
+		params[name] = fmt.Sprintf("#%X#", v)
+	}
+	return params
+}
+
 func Test_PublicKey_parse_ParsePofAPublicKeyCorrectly(t *testing.T) {
 	pk := &DSAPublicKey{}
 	_, ok := pk.Parse(serializedPublicKey)
@@ -955,7 +1089,48 @@ func Test_ImportKeys_willReturnARelevantErrorForIncorrectData(t *testing.T) {
   (px #00FC07ABCF0DC916AFF6E9AE47BEF60C7AB9B4D6B2469E436630E36F8A489BE812486A09F30B71224508654940A835301ACC525A4FF133FC152CC53DCC59D65C30A54F1993FE13FE63E5823D4C746DB21B90F9B9C00B49EC7404AB1D929BA7FBA12F2E45C6E0A651689750E8528AB8C031D3561FECEE72EBB4A090D450A9B7A858#)
   ))))`))
 	_, err := ImportKeys(from)
-	assertDeepEquals(t, err, newOtrError("couldn't import data into private key"))
+	assertDeepEquals(t, err, newOtrError(`couldn't import account 1 ("foo2"): sexp: unexpected form px in account.private-key.dsa`))
+}
+
+func Test_ImportKeys_willReturnThePositionOfASyntaxError(t *testing.T) {
+	from := bytes.NewBuffer([]byte(`(privkeys (account
+(name "foo2")
+(protocol libpurple-Jabberx)
+(private-key (dsa
+  (p #00FC07ABCF0DC916AFF6E9AE47BEF60C7AB9B4D6B2469E436630E36F8A489BE8X#)
+  ))))`))
+	_, err := ImportKeys(from)
+	assertDeepEquals(t, err, newOtrError("couldn't import data into private key: sexp: line 5, column 71: expected a hexadecimal digit, found 'X'"))
+}
+
+func Test_ImportKeys_willReturnWhichAccountIsMissingItsKey(t *testing.T) {
+	from := bytes.NewBuffer([]byte(`(privkeys
+(account (name "foo1") (protocol prpl-jabber) (private-key (dsa (p #00FC#))))
+(account (name "foo2") (protocol prpl-jabber)))`))
+	_, err := ImportKeys(from)
+	assertDeepEquals(t, err, newOtrError(`couldn't import account 2 ("foo2"): missing private-key.dsa`))
+}
+
+func Test_ImportKeys_willImportKeysInTheLibgcryptTransportFormat(t *testing.T) {
+	bt := bytes.NewBuffer(nil)
+	k, _ := exportPrivateKey(alicePrivateKey)
+	v, _ := sexp.MarshalForm("privkeys", privateKeyFile{Accounts: []privateKeyFileAccount{{
+		Name:     "foo@example.com",
+		Protocol: "prpl-jabber",
+		Key:      k,
+	}}})
+	_ = sexp.EncodeTransport(bt, v)
+
+	res, err := ImportKeys(bt)
+	assertNil(t, err)
+	assertEquals(t, res[0].Name, "foo@example.com")
+	assertEquals(t, res[0].Protocol, "prpl-jabber")
+	assertDeepEquals(t, res[0].Key.(*DSAPrivateKey).PrivateKey, alicePrivateKey.(*DSAPrivateKey).PrivateKey)
+}
+
+func Test_ImportKeys_willReturnAnErrorIfThereIsNoPrivkeysForm(t *testing.T) {
+	_, err := ImportKeys(bytes.NewBuffer([]byte(`(account (name "foo1"))`)))
+	assertDeepEquals(t, err, newOtrError("couldn't import data into private key: expected a privkeys form"))
 }
 
 func Test_ImportKeys_willReturnTheParsedAccountInformation(t *testing.T) {
@@ -986,7 +1161,7 @@ func Test_ImportKeysFromFile_willReturnAValidAccountReadFromAFile(t *testing.T)
 
 func Test_ImportKeysFromFile_willReturnAnErrorIfTheFileIsinvalid(t *testing.T) {
 	_, err := ImportKeysFromFile("test_resources/invalid_key.asc")
-	assertDeepEquals(t, err, newOtrError("couldn't import data into private key"))
+	assertDeepEquals(t, err, newOtrError(`couldn't import account 1 ("foo2"): sexp: unexpected form px in account.private-key.dsa`))
 }
 
 func Test_PrivateKey_ImportWithoutError(t *testing.T) {
@@ -1080,3 +1255,50 @@ func Test_ExportKeysToFile_returnsAnErrorIfSomethingGoesWrong(t *testing.T) {
 	err := ExportKeysToFile([]*Account{acc}, "non_existing_directory/test_export_of_keys.blah")
 	assertMatches(t, err.Error(), "open non_existing_directory/test_export_of_keys.blah: (no such file or directory|The system cannot find the path specified.)")
 }
+
+func Test_exportAccounts_escapesAccountNamesSoTheyCanBeImportedAgain(t *testing.T) {
+	priv := &DSAPrivateKey{}
+	priv.Parse(serializedPrivateKey)
+	acc := Account{Name: "hello \"there\"\\", Protocol: "go-xmpp", Key: priv}
+	bt := bytes.NewBuffer(make([]byte, 0, 200))
+	err := exportAccounts([]*Account{&acc}, bt)
+	assertNil(t, err)
+
+	res, err := ImportKeys(bt)
+	assertNil(t, err)
+	assertEquals(t, res[0].Name, acc.Name)
+	assertEquals(t, res[0].Protocol, acc.Protocol)
+}
+
+func Test_exportAccounts_returnsAnErrorForKeysThatCantBeExported(t *testing.T) {
+	s, _ := NewLoopbackSigner(alicePrivateKey, rand.Reader)
+	defer s.Close()
+	acc := Account{Name: "hello", Protocol: "go-xmpp", Key: NewSignerKey(s)}
+	bt := bytes.NewBuffer(nil)
+
+	err := exportAccounts([]*Account{&acc}, bt)
+	assertEquals(t, err, newOtrError("can't export private key of type *otr3.SignerKey"))
+	assertEquals(t, bt.Len(), 0)
+}
+
+func Test_DSAPublicKey_IsSame_comparesKeysByValue(t *testing.T) {
+	one := &DSAPublicKey{}
+	one.Parse(serializedPublicKey)
+	two := &DSAPublicKey{}
+	two.Parse(serializedPublicKey)
+
+	assertEquals(t, one.IsSame(two), true)
+	assertEquals(t, one.Equal(two), true)
+	assertEquals(t, one.Equal(alicePrivateKey.PublicKey()), false)
+}
+
+func Test_DSAPublicKey_Equal_isFalseForMissingKeys(t *testing.T) {
+	one := &DSAPublicKey{}
+	one.Parse(serializedPublicKey)
+	var none *DSAPublicKey
+
+	assertEquals(t, one.Equal(nil), false)
+	assertEquals(t, one.Equal(none), false)
+	assertEquals(t, none.Equal(one), false)
+	assertEquals(t, (&DSAPublicKey{}).Equal(&DSAPublicKey{}), false)
+}
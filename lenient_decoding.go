@@ -0,0 +1,47 @@
+package otr3
+
+// SetLenientDecoding makes Receive ignore whitespace inside encoded OTR messages and fragments, which some gateways
+// insert when they wrap long lines. It is off by default, so that mangled messages are reported instead of guessed at.
+func (c *Conversation) SetLenientDecoding(v bool) {
+	c.lenientDecoding = v
+}
+
+func isWhitespace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
+
+func removeWhitespace(data []byte) []byte {
+	result := make([]byte, 0, len(data))
+	for _, b := range data {
+		if !isWhitespace(b) {
+			result = append(result, b)
+		}
+	}
+	return result
+}
+
+// removeEnvelopeWhitespace removes all whitespace from the encoded message or fragment at the start of the message,
+// up to the end of it. Whitespace can never be a part of them, since they only contain base64 data, digits and separators.
+func removeEnvelopeWhitespace(msg []byte) []byte {
+	if !isEncodedOrFragment(msg) {
+		return msg
+	}
+
+	withoutWhitespace := removeWhitespace(msg)
+	end := embeddedMessageLength(withoutWhitespace)
+	if end == 0 {
+		return withoutWhitespace
+	}
+
+	// The text after the end is kept as it was, so it can be surfaced as surrounding text, unless it's only whitespace
+	rest := msg
+	for seen := 0; seen < end; rest = rest[1:] {
+		if !isWhitespace(rest[0]) {
+			seen++
+		}
+	}
+	if len(removeWhitespace(rest)) == 0 {
+		return withoutWhitespace[:end]
+	}
+	return append(withoutWhitespace[:end:end], rest...)
+}
@@ -0,0 +1,95 @@
+package otr3
+
+import (
+	"strings"
+	"testing"
+)
+
+// wrapEvery inserts the separator into the message every n bytes, like a gateway wrapping long lines
+func wrapEvery(m ValidMessage, n int, sep string) ValidMessage {
+	var res []byte
+	for len(m) > n {
+		res = append(append(res, m[:n]...), sep...)
+		m = m[n:]
+	}
+	return append(res, m...)
+}
+
+func Test_Receive_rejectsWrappedMessagesByDefault(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	msgs, _ := alice.Send(ValidMessage("hello"))
+
+	_, _, err := bob.Receive(wrapEvery(msgs[0], 40, " "))
+	assertEquals(t, err, errInvalidOTRMessage)
+}
+
+func Test_Receive_acceptsMangledMessagesWithLenientDecoding(t *testing.T) {
+	samples := []struct {
+		name string
+		f    func(ValidMessage) ValidMessage
+	}{
+		{"folded like a mail header", func(m ValidMessage) ValidMessage { return wrapEvery(m, 76, "\r\n ") }},
+		{"split by spaces", func(m ValidMessage) ValidMessage { return wrapEvery(m, 20, " ") }},
+		{"split by tabs and newlines", func(m ValidMessage) ValidMessage { return wrapEvery(m, 33, "\t\n") }},
+		{"split in the prefix", func(m ValidMessage) ValidMessage { return wrapEvery(m, 7, " ") }},
+		{"with a trailing line break", func(m ValidMessage) ValidMessage { return append(m, "\r\n"...) }},
+	}
+
+	for _, s := range samples {
+		alice, bob := conversationsAfterAKE(t)
+		bob.SetLenientDecoding(true)
+		msgs, _ := alice.Send(ValidMessage("hello"))
+
+		plain, _, err := bob.Receive(s.f(msgs[0]))
+		if err != nil {
+			t.Errorf("%s: %v", s.name, err)
+		}
+		assertEquals(t, string(plain), "hello")
+	}
+}
+
+func Test_Receive_acceptsMangledFragmentsWithLenientDecoding(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	alice.SetFragmentSize(120)
+	bob.SetLenientDecoding(true)
+	var surrounding [][]byte
+	bob.SetMessageEventHandler(dynamicMessageEventHandler{func(e MessageEvent, m []byte, _ error, _ ...interface{}) {
+		if e == MessageEventReceivedMessageWithSurroundingText {
+			surrounding = append(surrounding, m)
+		}
+	}})
+
+	message := strings.Repeat("hello world ", 30)
+	msgs, _ := alice.Send(ValidMessage(message))
+	assertEquals(t, len(msgs) > 2, true)
+
+	var plain MessagePlaintext
+	for i, m := range msgs {
+		mangled := wrapEvery(m, 10+i, "\n ")
+		p, _, err := bob.Receive(append(mangled, "\r\n"...))
+		assertNil(t, err)
+		if p != nil {
+			plain = p
+		}
+	}
+
+	assertEquals(t, string(plain), message)
+	assertEquals(t, len(surrounding), 0)
+}
+
+func Test_Receive_leavesWhitespaceInPlainMessagesWithLenientDecoding(t *testing.T) {
+	c := &Conversation{}
+	c.Policies = policies(allowV3)
+	c.SetLenientDecoding(true)
+
+	plain, _, err := c.Receive(ValidMessage("hello  there\n how are you?"))
+	assertNil(t, err)
+	assertEquals(t, string(plain), "hello  there\n how are you?")
+}
+
+func Test_removeEnvelopeWhitespace_keepsTheTextAfterTheMessage(t *testing.T) {
+	assertEquals(t, string(removeEnvelopeWhitespace([]byte("?OTR:AA MD\nab. and more  text"))), "?OTR:AAMDab. and more  text")
+	assertEquals(t, string(removeEnvelopeWhitespace([]byte("?OTR,000 01,00002,a b, c"))), "?OTR,00001,00002,ab, c")
+	assertEquals(t, string(removeEnvelopeWhitespace([]byte("?OTR:AA MD"))), "?OTR:AAMD")
+	assertEquals(t, string(removeEnvelopeWhitespace([]byte("?OTRv3? let's talk"))), "?OTRv3? let's talk")
+}
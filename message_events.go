@@ -56,6 +56,14 @@ const (
 
 	// MessageEventReceivedMessageForOtherInstance is triggered when we receive and discard a message for another instance
 	MessageEventReceivedMessageForOtherInstance
+
+	// MessageEventSetupTimeout is signaled when the peer stopped answering in the middle of the AKE, and the AKE was abandoned.
+	// The error attached says which state the AKE was in.
+	MessageEventSetupTimeout
+
+	// MessageEventReceivedMessageWithSurroundingText is signaled when an OTR message was found in the middle of a message,
+	// for example after a nickname or inside HTML markup. The message attached is the text around the OTR message.
+	MessageEventReceivedMessageWithSurroundingText
 )
 
 // MessageEventHandler handles MessageEvents
@@ -125,6 +133,10 @@ func (s MessageEvent) String() string {
 		return "MessageEventReceivedMessageUnrecognized"
 	case MessageEventReceivedMessageForOtherInstance:
 		return "MessageEventReceivedMessageForOtherInstance"
+	case MessageEventSetupTimeout:
+		return "MessageEventSetupTimeout"
+	case MessageEventReceivedMessageWithSurroundingText:
+		return "MessageEventReceivedMessageWithSurroundingText"
 	default:
 		return "MESSAGE EVENT: (THIS SHOULD NEVER HAPPEN)"
 	}
@@ -234,6 +234,9 @@ func (c *dataMsg) deserialize(msg []byte, v otrVersion) error {
 	}
 
 	msg = msg[len(c.serializeUnsignedCache):]
+	if len(msg) < v.hashLength() {
+		return newOtrError("dataMsg.deserialize corrupted authenticator")
+	}
 	c.authenticator = msg[0:v.hashLength()]
 	msg = msg[len(c.authenticator):]
 
@@ -305,9 +308,25 @@ const (
 	nulByteLen         = 1
 )
 
+// paddedLength is the length the padding is calculated from: the message, the NUL byte after it and the header of the padding TLV
+func (c plainDataMsg) paddedLength() int {
+	return len(c.message) + tlvHeaderLen + nulByteLen
+}
+
+// serializedLengthWithPadding is the length of the serialized message, including its TLVs, and the header of the padding TLV
+func (c plainDataMsg) serializedLengthWithPadding() int {
+	length := c.paddedLength()
+	for _, t := range c.tlvs {
+		length += tlvHeaderLen + len(t.tlvValue)
+	}
+	return length
+}
+
 func (c plainDataMsg) pad() plainDataMsg {
-	padding := paddingGranularity - ((len(c.message) + tlvHeaderLen + nulByteLen) % paddingGranularity)
+	return c.padWith(paddingGranularity - (c.paddedLength() % paddingGranularity))
+}
 
+func (c plainDataMsg) padWith(padding int) plainDataMsg {
 	paddingTlv := tlv{
 		tlvType:   uint16(tlvTypePadding),
 		tlvLength: uint16(padding),
@@ -320,10 +339,13 @@ func (c plainDataMsg) pad() plainDataMsg {
 }
 
 func (c plainDataMsg) encrypt(key []byte, topHalfCtr [8]byte) []byte {
+	return encryptSerialized(key, topHalfCtr, c.pad().serialize())
+}
+
+func encryptSerialized(key []byte, topHalfCtr [8]byte, data []byte) []byte {
 	var iv [aes.BlockSize]byte
 	copy(iv[:], topHalfCtr[:])
 
-	data := c.pad().serialize()
 	dst := make([]byte, len(data))
 	_ = counterEncipher(key, iv[:], data, dst)
 
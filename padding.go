@@ -1,5 +1,114 @@
 package otr3
 
+import (
+	"encoding/binary"
+	"io"
+)
+
+// PaddingStrategy decides how the length of encrypted messages is hidden
+type PaddingStrategy int
+
+const (
+	// PaddingFixedBuckets pads messages up to the next multiple of the bucket size. This is the default.
+	PaddingFixedBuckets PaddingStrategy = iota
+	// PaddingNone doesn't pad messages, so their length is visible to anyone who can see the encrypted messages
+	PaddingNone
+	// PaddingExponentialBuckets pads messages up to the next bucket in the series BucketSize, 2*BucketSize, 4*BucketSize and so on,
+	// which hides more of the length of long messages than fixed buckets do, for less bandwidth than large fixed buckets need
+	PaddingExponentialBuckets
+	// PaddingRandom adds a random amount of padding, between zero and MaxRandomPadding bytes, to every message
+	PaddingRandom
+)
+
+const (
+	// maxPadding is the most padding a padding TLV can hold
+	maxPadding = 0xFFFF
+
+	defaultMaxRandomPadding = 256
+)
+
+// PaddingPolicy configures the padding that is added to every encrypted message, in a padding TLV, which all OTR
+// implementations ignore. The zero value pads messages to multiples of 256 bytes.
+type PaddingPolicy struct {
+	Strategy PaddingStrategy
+	// BucketSize is the size of the buckets for PaddingFixedBuckets, and of the smallest bucket for PaddingExponentialBuckets.
+	// It defaults to 256 bytes.
+	BucketSize int
+	// MaxRandomPadding is the most padding PaddingRandom adds. It defaults to 256 bytes.
+	MaxRandomPadding int
+	// CountTLVs makes the padding take the TLVs sent with the message into account, such as SMP messages,
+	// so that their length is hidden as well. Without it, only the length of the message text is padded,
+	// like earlier versions did.
+	CountTLVs bool
+}
+
+// SetPaddingPolicy sets the policy for padding encrypted messages, to trade bandwidth for hiding their length
+func (c *Conversation) SetPaddingPolicy(p PaddingPolicy) {
+	c.paddingPolicy = p
+}
+
+func (p PaddingPolicy) bucketSize() int {
+	if p.BucketSize <= 0 {
+		return paddingGranularity
+	}
+	return p.BucketSize
+}
+
+func (p PaddingPolicy) maxRandomPadding() int {
+	if p.MaxRandomPadding <= 0 {
+		return defaultMaxRandomPadding
+	}
+	return p.MaxRandomPadding
+}
+
+// paddingFor returns how much padding a message of the given length needs, and false if no padding TLV should be added.
+// Without a source of randomness, it returns the most padding PaddingRandom could add.
+func (p PaddingPolicy) paddingFor(length int, r io.Reader) (int, bool, error) {
+	var padding int
+
+	switch p.Strategy {
+	case PaddingNone:
+		return 0, false, nil
+	case PaddingExponentialBuckets:
+		bucket := p.bucketSize()
+		for bucket < length {
+			bucket *= 2
+		}
+		padding = bucket - length
+	case PaddingRandom:
+		padding = p.maxRandomPadding()
+		if r != nil {
+			var b [4]byte
+			if err := randomInto(r, b[:]); err != nil {
+				return 0, false, err
+			}
+			padding = int(binary.BigEndian.Uint32(b[:]) % uint32(padding+1))
+		}
+	default:
+		size := p.bucketSize()
+		padding = size - (length % size)
+	}
+
+	if padding > maxPadding {
+		padding = maxPadding
+	}
+	return padding, true, nil
+}
+
+// padPlaintext adds padding to the message according to the padding policy
+func (c *Conversation) padPlaintext(plain plainDataMsg, r io.Reader) (plainDataMsg, error) {
+	length := plain.paddedLength()
+	if c.paddingPolicy.CountTLVs {
+		length = plain.serializedLengthWithPadding()
+	}
+
+	padding, ok, err := c.paddingPolicy.paddingFor(length, r)
+	if err != nil || !ok {
+		return plain, err
+	}
+	return plain.padWith(padding), nil
+}
+
 func (c *Conversation) processPaddingTLV(tlv, dataMessageExtra) (toSend *tlv, err error) {
 	return nil, nil
 }
@@ -0,0 +1,190 @@
+package otr3
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// parseLikeLibOTR splits a decrypted data message the way libotr does: the message ends at the first NUL byte,
+// and otrl_tlv_parse reads TLVs while there is room for a header, stopping at a TLV longer than the data left.
+func parseLikeLibOTR(data []byte) (message []byte, tlvs []tlv, leftover int) {
+	nul := bytes.IndexByte(data, 0)
+	if nul < 0 {
+		return data, nil, 0
+	}
+	message, data = data[:nul], data[nul+1:]
+
+	for len(data) >= tlvHeaderLen {
+		_, tlvType, _ := ExtractShort(data)
+		_, tlvLength, _ := ExtractShort(data[2:])
+		if int(tlvLength) > len(data)-tlvHeaderLen {
+			break
+		}
+		tlvs = append(tlvs, tlv{tlvType: tlvType, tlvLength: tlvLength, tlvValue: data[tlvHeaderLen : tlvHeaderLen+int(tlvLength)]})
+		data = data[tlvHeaderLen+int(tlvLength):]
+	}
+	return message, tlvs, len(data)
+}
+
+var testPaddingPolicies = []PaddingPolicy{
+	{},
+	{Strategy: PaddingNone},
+	{Strategy: PaddingFixedBuckets, BucketSize: 100},
+	{Strategy: PaddingExponentialBuckets},
+	{Strategy: PaddingExponentialBuckets, BucketSize: 64},
+	{Strategy: PaddingRandom},
+	{Strategy: PaddingRandom, MaxRandomPadding: 1000},
+	{Strategy: PaddingFixedBuckets, CountTLVs: true},
+	{Strategy: PaddingExponentialBuckets, CountTLVs: true},
+}
+
+func Test_PaddingPolicy_paddingFor_padsToFixedBuckets(t *testing.T) {
+	p := PaddingPolicy{}
+	for length, expected := range map[int]int{1: 255, 255: 1, 256: 256, 300: 212} {
+		padding, ok, err := p.paddingFor(length, nil)
+		assertNil(t, err)
+		assertEquals(t, ok, true)
+		assertEquals(t, padding, expected)
+	}
+
+	padding, _, _ := PaddingPolicy{BucketSize: 100}.paddingFor(150, nil)
+	assertEquals(t, padding, 50)
+}
+
+func Test_PaddingPolicy_paddingFor_padsToExponentialBuckets(t *testing.T) {
+	p := PaddingPolicy{Strategy: PaddingExponentialBuckets, BucketSize: 64}
+	for length, expected := range map[int]int{1: 63, 64: 0, 65: 63, 200: 56, 1000: 24} {
+		padding, ok, _ := p.paddingFor(length, nil)
+		assertEquals(t, ok, true)
+		assertEquals(t, padding, expected)
+	}
+}
+
+func Test_PaddingPolicy_paddingFor_neverPadsMoreThanATLVCanHold(t *testing.T) {
+	padding, _, _ := PaddingPolicy{Strategy: PaddingExponentialBuckets, BucketSize: 200000}.paddingFor(10, nil)
+	assertEquals(t, padding, maxPadding)
+	padding, _, _ = PaddingPolicy{BucketSize: 100000}.paddingFor(10, nil)
+	assertEquals(t, padding, maxPadding)
+}
+
+func Test_PaddingPolicy_paddingFor_doesntPadWithPaddingNone(t *testing.T) {
+	_, ok, err := PaddingPolicy{Strategy: PaddingNone}.paddingFor(10, nil)
+	assertNil(t, err)
+	assertEquals(t, ok, false)
+}
+
+func Test_PaddingPolicy_paddingFor_usesTheRandomnessForRandomPadding(t *testing.T) {
+	p := PaddingPolicy{Strategy: PaddingRandom, MaxRandomPadding: 99}
+
+	padding, _, err := p.paddingFor(10, fixedRand([]string{"000004d2"}))
+	assertNil(t, err)
+	assertEquals(t, padding, 1234%100)
+
+	padding, _, _ = p.paddingFor(10, nil)
+	assertEquals(t, padding, 99)
+
+	_, _, err = p.paddingFor(10, fixedRand([]string{"00"}))
+	assertEquals(t, err, errShortRandomRead)
+}
+
+func Test_padPlaintext_producesDataThatLibOTRParses(t *testing.T) {
+	c := &Conversation{}
+	abort := smpMessageAbort{}.tlv()
+
+	for _, p := range testPaddingPolicies {
+		c.SetPaddingPolicy(p)
+		for _, l := range []int{0, 1, 250, 251, 252, 255, 256, 1000, 5000} {
+			message := []byte(strings.Repeat("x", l))
+			plain, err := c.padPlaintext(plainDataMsg{message: message, tlvs: []tlv{abort}}, c.rand())
+			assertNil(t, err)
+
+			parsedMessage, tlvs, leftover := parseLikeLibOTR(plain.serialize())
+			assertDeepEquals(t, parsedMessage, message)
+			assertEquals(t, leftover, 0)
+			assertEquals(t, tlvs[0].tlvType, abort.tlvType)
+
+			if p.Strategy == PaddingNone {
+				assertEquals(t, len(tlvs), 1)
+				continue
+			}
+			assertEquals(t, len(tlvs), 2)
+			assertEquals(t, tlvs[1].tlvType, tlvTypePadding)
+			assertDeepEquals(t, tlvs[1].tlvValue, make([]byte, tlvs[1].tlvLength))
+		}
+	}
+}
+
+func Test_padPlaintext_hidesTheLengthInsideBuckets(t *testing.T) {
+	c := &Conversation{}
+	c.SetPaddingPolicy(PaddingPolicy{Strategy: PaddingExponentialBuckets, BucketSize: 128})
+
+	lengths := map[int]bool{}
+	for l := 200; l < 240; l++ {
+		plain, _ := c.padPlaintext(plainDataMsg{message: make([]byte, l)}, nil)
+		lengths[len(plain.serialize())] = true
+	}
+	assertDeepEquals(t, lengths, map[int]bool{256: true})
+}
+
+func Test_padPlaintext_padsLikeBeforeByDefault(t *testing.T) {
+	c := &Conversation{}
+	plain := plainDataMsg{message: []byte("hello"), tlvs: []tlv{fixtureMessage1().tlv()}}
+
+	padded, err := c.padPlaintext(plain, nil)
+	assertNil(t, err)
+	assertDeepEquals(t, padded.serialize(), plain.pad().serialize())
+}
+
+func Test_padPlaintext_includesTheTLVsInTheBucketWhenAskedTo(t *testing.T) {
+	c := &Conversation{}
+	c.SetPaddingPolicy(PaddingPolicy{CountTLVs: true})
+	smp := fixtureMessage1().tlv()
+
+	plain, err := c.padPlaintext(plainDataMsg{message: []byte("hello"), tlvs: []tlv{smp}}, nil)
+	assertNil(t, err)
+
+	assertEquals(t, len(plain.tlvs), 2)
+	assertEquals(t, len(plain.serialize())%paddingGranularity, 0)
+}
+
+func Test_PaddingPolicy_messagesCanBeReadByThePeer(t *testing.T) {
+	for _, p := range testPaddingPolicies {
+		alice, bob := conversationsAfterAKE(t)
+		alice.SetPaddingPolicy(p)
+
+		for _, m := range []string{"hi", strings.Repeat("hello ", 100)} {
+			msgs, err := alice.Send(ValidMessage(m))
+			assertNil(t, err)
+			assertEquals(t, string(receiveAll(t, bob, msgs...)), m)
+		}
+
+		completeSMP(t, alice, bob, "", []byte("secret"), []byte("secret"))
+		assertEquals(t, alice.IsVerified(), true)
+	}
+}
+
+func Test_PaddingPolicy_changesTheSizeOfMessages(t *testing.T) {
+	alice, _ := conversationsAfterAKE(t)
+	message := ValidMessage("hello")
+
+	padded, _ := alice.Send(message)
+	alice.SetPaddingPolicy(PaddingPolicy{Strategy: PaddingNone})
+	unpadded, _ := alice.Send(message)
+	estimate, _ := alice.EstimateWireSize(message)
+
+	assertEquals(t, len(unpadded[0]) < len(padded[0]), true)
+	assertEquals(t, estimate.EncodedSize, len(unpadded[0]))
+}
+
+func Test_EstimateWireSize_usesTheMostRandomPadding(t *testing.T) {
+	alice, _ := conversationsAfterAKE(t)
+	alice.SetPaddingPolicy(PaddingPolicy{Strategy: PaddingRandom, MaxRandomPadding: 500})
+	message := ValidMessage("hello")
+
+	estimate, _ := alice.EstimateWireSize(message)
+	for i := 0; i < 10; i++ {
+		msgs, _ := alice.Send(message)
+		assertEquals(t, len(msgs[0]) <= estimate.EncodedSize, true)
+	}
+}
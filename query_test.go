@@ -67,6 +67,20 @@ func Test_receiveQueryMessage_sendDHCommitv3AndTransitToStateAwaitingDHKey(t *te
 	assertDeepEquals(t, dhMsgVersion(msg[0]), uint16(3))
 }
 
+func Test_receiveQueryMessage_answersARepeatedQueryMessageWithANewDHCommit(t *testing.T) {
+	c := &Conversation{Policies: policies(allowV3)}
+	c.SetOurKeys([]PrivateKey{bobPrivateKey})
+
+	msg, err := c.receiveQueryMessage([]byte("?OTRv3?"))
+	assertNil(t, err)
+	assertEquals(t, len(msg), 1)
+
+	msg, err = c.receiveQueryMessage([]byte("?OTRv3?"))
+	assertNil(t, err)
+	assertEquals(t, len(msg), 1)
+	assertDeepEquals(t, dhMsgType(msg[0]), msgTypeDHCommit)
+}
+
 func Test_receiveQueryMessageV2_sendDHCommitv2(t *testing.T) {
 	queryMsg := []byte("?OTRvx23?")
 
@@ -14,7 +14,29 @@ func (c *Conversation) receiveUnit(m ValidMessage, forgetFragments bool) (plain
 		return c.receiveWithoutOTR(message)
 	}
 
+	if c.binaryTransport && isBinaryFrame(message) {
+		return c.receiveBinary(message, forgetFragments)
+	}
+
+	if c.lenientDecoding {
+		message = removeEnvelopeWhitespace(message)
+		defer wipeBytes(message)
+	}
+
 	msgType := guessMessageType(message)
+	if msgType == msgGuessNotOTR && c.htmlAware {
+		if guess, stripped := guessMessageTypeInHTML(message); guess != msgGuessNotOTR {
+			return c.receiveHTML(guess, message, stripped, forgetFragments)
+		}
+	}
+
+	if c.findEmbedded {
+		if otr, surrounding, ok := findOTRMessage(message); ok {
+			c.surroundingText(surrounding)
+			return c.receiveUnit(otr, forgetFragments)
+		}
+	}
+
 	var messagesToSend []messageWithHeader
 	shouldForgetFragment := true
 	switch msgType {
@@ -170,6 +192,8 @@ func (c *Conversation) receiveDataMessage(messageHeader, messageBody []byte) (pl
 		c.notifyDataMessageError(err)
 	}
 
+	plain = c.convertMessage(ConvertReceiving, plain)
+
 	return
 }
 
@@ -122,7 +122,7 @@ func (c *Conversation) retransmit() ([]messageWithHeader, error) {
 		if resending {
 			msg = c.resendMessageTransformer()(msg)
 		}
-		dataMsg, _, err := c.genDataMsg(msg)
+		dataMsg, _, err := c.genDataMsg(c.convertMessage(ConvertSending, msg))
 		if err != nil {
 			return nil, err
 		}
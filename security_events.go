@@ -12,6 +12,12 @@ const (
 	GoneSecure
 	// StillSecure is signalled when we have refreshed the security state but is still in a secure state
 	StillSecure
+	// PeerKeyChanged is signalled when a new AKE during an encrypted conversation finished, but the peer
+	// authenticated with a different long-term key than the one used before
+	PeerKeyChanged
+	// PeerVerified is signalled after the AKE finished, when the trust store has a record of an earlier SMP authentication
+	// verifying the same pair of long-term keys
+	PeerVerified
 )
 
 // SecurityEventHandler is an interface for events that are related to changes of security status
@@ -43,6 +49,10 @@ func (s SecurityEvent) String() string {
 		return "GoneSecure"
 	case StillSecure:
 		return "StillSecure"
+	case PeerKeyChanged:
+		return "PeerKeyChanged"
+	case PeerVerified:
+		return "PeerVerified"
 	default:
 		return "SECURITY EVENT: (THIS SHOULD NEVER HAPPEN)"
 	}
@@ -3,6 +3,7 @@ package otr3
 import (
 	"bufio"
 	"bytes"
+	"time"
 )
 
 // Send takes a human readable message from the local user, possibly encrypts
@@ -46,13 +47,14 @@ func (c *Conversation) sendMessageOnPlaintext(message ValidMessage, trace ...int
 }
 
 func (c *Conversation) sendMessageOnEncrypted(message ValidMessage) ([]ValidMessage, error) {
-	result, _, err := c.createSerializedDataMessage(message, messageFlagNormal, []tlv{})
+	result, _, err := c.createSerializedDataMessage(c.convertMessage(ConvertSending, message), messageFlagNormal, []tlv{})
 	if err != nil {
 		c.messageEvent(MessageEventEncryptionError)
 		c.generatePotentialErrorMessage(ErrorCodeEncryptionError)
+		return result, err
 	}
 
-	return result, err
+	return c.applyFragmentPolicy(result), nil
 }
 
 func (c *Conversation) sendDHCommit() (toSend messageWithHeader, err error) {
@@ -70,6 +72,7 @@ func (c *Conversation) sendDHCommit() (toSend messageWithHeader, err error) {
 	}
 
 	c.ake.state = authStateAwaitingDHKey{}
+	c.ake.waitingSince = time.Now()
 
 	return
 }
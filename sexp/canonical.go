@@ -0,0 +1,179 @@
+package sexp
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// EncodeCanonical will write the given value to the writer in the canonical S-Expression format used by libgcrypt.
+// Every atom is written as a length prefixed octet string, such as 3:abc, and no whitespace is used.
+// Bignums are written as their big-endian bytes, with a leading zero byte if the high bit is set,
+// the same way libgcrypt prints them.
+func EncodeCanonical(w io.Writer, v Value) error {
+	bw := bufio.NewWriter(w)
+	if err := encodeCanonicalValue(bw, v); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// EncodeTransport will write the given value to the writer in the base64 transport format used by libgcrypt,
+// which is the canonical format encoded in base64 and enclosed in braces.
+func EncodeTransport(w io.Writer, v Value) error {
+	var b strings.Builder
+	if err := EncodeCanonical(&b, v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "{"+base64.StdEncoding.EncodeToString([]byte(b.String()))+"}")
+	return err
+}
+
+func encodeCanonicalValue(w *bufio.Writer, v Value) error {
+	switch vv := v.(type) {
+	case Snil:
+		_, err := w.WriteString("()")
+		return err
+	case Cons:
+		elements, err := listElements(vv)
+		if err != nil {
+			return err
+		}
+		_, _ = w.WriteString("(")
+		for _, e := range elements {
+			if err := encodeCanonicalValue(w, e); err != nil {
+				return err
+			}
+		}
+		_, err = w.WriteString(")")
+		return err
+	default:
+		data, err := canonicalAtom(v)
+		if err != nil {
+			return err
+		}
+		_, _ = w.WriteString(strconv.Itoa(len(data)))
+		_, _ = w.WriteString(":")
+		_, err = w.Write(data)
+		return err
+	}
+}
+
+func canonicalAtom(v Value) ([]byte, error) {
+	switch vv := v.(type) {
+	case Symbol:
+		return []byte(vv), nil
+	case Sstring:
+		return []byte(vv), nil
+	case Octets:
+		return []byte(vv), nil
+	case BigNum:
+		if vv.val == nil {
+			return nil, errors.New("sexp: can't encode an empty bignum")
+		}
+		if vv.val.Sign() < 0 {
+			return nil, errors.New("sexp: can't encode a negative bignum")
+		}
+		data := vv.val.Bytes()
+		if len(data) == 0 || data[0]&0x80 != 0 {
+			data = append([]byte{0}, data...)
+		}
+		return data, nil
+	case nil:
+		return nil, errors.New("sexp: can't encode a nil value")
+	default:
+		return nil, fmt.Errorf("sexp: can't encode value of type %T", v)
+	}
+}
+
+// verbatim reads a length prefixed octet string, such as 3:abc. If the digits are not followed by a colon,
+// they are read as the start of a symbol instead.
+func (p *parser) verbatim() (Value, error) {
+	var digits []byte
+	c, err := peek(p)
+	for err == nil && c >= '0' && c <= '9' {
+		_, _ = p.ReadByte()
+		digits = append(digits, c)
+		c, err = peek(p)
+	}
+
+	if err != nil || c != ':' {
+		return Symbol(append(digits, []byte(p.symbol().(Symbol))...)), nil
+	}
+
+	start := p.pos
+	_, _ = p.ReadByte()
+	l, err := strconv.Atoi(string(digits))
+	if err != nil {
+		return nil, p.errorAt(start, "a valid length", fmt.Sprintf("%q", digits))
+	}
+
+	result := make([]byte, 0, 10)
+	for len(result) < l {
+		c, err := p.ReadByte()
+		if err != nil {
+			return nil, p.unexpected(fmt.Sprintf("a %d byte string", l))
+		}
+		result = append(result, c)
+	}
+	return Octets(result), nil
+}
+
+// readBase64 reads base64 data until the given end character, ignoring whitespace
+func (p *parser) readBase64(end byte) ([]byte, error) {
+	start := p.pos
+	var data []byte
+	for {
+		c, err := p.ReadByte()
+		if err != nil {
+			return nil, p.unexpected(fmt.Sprintf("%q", end))
+		}
+		if c == end {
+			break
+		}
+		if !isWhitespace(c) {
+			data = append(data, c)
+		}
+	}
+
+	result, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, p.errorAt(start, "base64 data", "malformed base64")
+	}
+	return result, nil
+}
+
+// base64String reads a base64 encoded octet string, such as |YWJj|
+func (p *parser) base64String() (Value, error) {
+	if err := p.expect('|'); err != nil {
+		return nil, err
+	}
+	result, err := p.readBase64('|')
+	if err != nil {
+		return nil, err
+	}
+	return Octets(result), nil
+}
+
+// transport reads a base64 encoded canonical S-Expression, such as {KDM6YWJjKQ==}
+func (p *parser) transport() (Value, error) {
+	start := p.pos
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	data, err := p.readBase64('}')
+	if err != nil {
+		return nil, err
+	}
+
+	inner := newParser(strings.NewReader(string(data)))
+	res, err := inner.value()
+	if err != nil {
+		return nil, p.errorAt(start, "a well formed transport encoded expression", err.Error())
+	}
+	return res, nil
+}
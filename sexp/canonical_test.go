@@ -0,0 +1,98 @@
+package sexp
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func Test_EncodeCanonical_writesLengthPrefixedAtoms(t *testing.T) {
+	b := new(bytes.Buffer)
+	err := EncodeCanonical(b, List(Symbol("name"), Sstring("foo bar"), List()))
+	assertEquals(t, err, nil)
+	assertEquals(t, b.String(), "(4:name7:foo bar())")
+}
+
+func Test_EncodeCanonical_writesBigNumsAsUnsignedBigEndianBytes(t *testing.T) {
+	b := new(bytes.Buffer)
+	_ = EncodeCanonical(b, List(NewBigNum("7F01"), NewBigNum("8001")))
+	assertEquals(t, b.String(), "(2:\x7F\x013:\x00\x80\x01)")
+}
+
+func Test_EncodeCanonical_returnsAnErrorForAnEmptyBigNum(t *testing.T) {
+	err := EncodeCanonical(new(bytes.Buffer), List(BigNum{}))
+	assertEquals(t, err.Error(), "sexp: can't encode an empty bignum")
+}
+
+func Test_EncodeTransport_writesTheCanonicalFormInBase64(t *testing.T) {
+	b := new(bytes.Buffer)
+	err := EncodeTransport(b, List(Sstring("abc")))
+	assertEquals(t, err, nil)
+	assertEquals(t, b.String(), "{KDM6YWJjKQ==}")
+}
+
+func Test_Parse_willParseCanonicalExpressions(t *testing.T) {
+	result, err := Parse(strings.NewReader("(4:name7:foo bar())"))
+	assertEquals(t, err, nil)
+	assertDeepEquals(t, result, List(Octets("name"), Octets("foo bar"), List()))
+}
+
+func Test_Parse_willParseVerbatimStringsInsideAdvancedExpressions(t *testing.T) {
+	result, err := Parse(strings.NewReader("(name 3:a)b)"))
+	assertEquals(t, err, nil)
+	assertDeepEquals(t, result, List(Symbol("name"), Octets("a)b")))
+}
+
+func Test_Parse_willParseSymbolsStartingWithDigits(t *testing.T) {
+	result, err := Parse(strings.NewReader("(123 4abc)"))
+	assertEquals(t, err, nil)
+	assertDeepEquals(t, result, List(Symbol("123"), Symbol("4abc")))
+}
+
+func Test_Parse_willReturnAnErrorForAShortVerbatimString(t *testing.T) {
+	_, err := Parse(strings.NewReader("5:ab"))
+	assertDeepEquals(t, err, &ParseError{Line: 1, Column: 5, Expected: "a 5 byte string", Found: "end of input"})
+}
+
+func Test_Parse_willParseBase64Strings(t *testing.T) {
+	result, err := Parse(strings.NewReader("(name |Zm9v\n YmFy|)"))
+	assertEquals(t, err, nil)
+	assertDeepEquals(t, result, List(Symbol("name"), Octets("foobar")))
+}
+
+func Test_Parse_willReturnAnErrorForMalformedBase64(t *testing.T) {
+	_, err := Parse(strings.NewReader("(name |Zm9v!|)"))
+	assertDeepEquals(t, err, &ParseError{Line: 1, Column: 8, Expected: "base64 data", Found: "malformed base64"})
+}
+
+func Test_Parse_willParseTransportEncodedExpressions(t *testing.T) {
+	result, err := Parse(strings.NewReader("{KDM6YWJjKQ==}"))
+	assertEquals(t, err, nil)
+	assertDeepEquals(t, result, List(Octets("abc")))
+}
+
+func Test_Parse_willReturnAnErrorForATransportEncodedExpressionThatIsMalformed(t *testing.T) {
+	_, err := Parse(strings.NewReader("  {KDM6YWI=}"))
+	assertDeepEquals(t, err, &ParseError{Line: 1, Column: 3, Expected: "a well formed transport encoded expression",
+		Found: "sexp: line 1, column 6: expected a 3 byte string, found end of input"})
+}
+
+func Test_canonicalFormat_roundTripsThroughMarshaling(t *testing.T) {
+	type dsa struct {
+		P *big.Int `sexp:"p"`
+		Q *big.Int `sexp:"q"`
+	}
+	in := dsa{P: big.NewInt(0xFF01), Q: big.NewInt(3)}
+	v, _ := MarshalForm("dsa", in)
+
+	b := new(bytes.Buffer)
+	_ = EncodeTransport(b, v)
+	read, err := Parse(b)
+	assertEquals(t, err, nil)
+
+	var out dsa
+	err = UnmarshalForm(read, "dsa", &out)
+	assertEquals(t, err, nil)
+	assertDeepEquals(t, out, in)
+}
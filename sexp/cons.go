@@ -57,18 +57,25 @@ func ReadList(r *bufio.Reader) Value {
 		return nil
 	}
 	result := ReadListItem(r)
-	if !ReadListEnd(r) {
+	if result == nil || !ReadListEnd(r) {
 		return nil
 	}
 	return result
 }
 
-// ReadListItem recursively read a list item and the next potential item
+// ReadListItem recursively read a list item and the next potential item. It returns nil if any of the items are malformed.
 func ReadListItem(r *bufio.Reader) Value {
 	ReadWhitespace(r)
 	val, end := ReadValue(r)
 	if end {
 		return Snil{}
 	}
-	return Cons{val, ReadListItem(r)}
+	if val == nil {
+		return nil
+	}
+	rest := ReadListItem(r)
+	if rest == nil {
+		return nil
+	}
+	return Cons{val, rest}
 }
@@ -0,0 +1,186 @@
+package sexp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const encodeIndent = "  "
+
+// Encode will write the given value to the writer in the advanced S-Expression format used by libotr and libgcrypt.
+// Lists that contain other lists are spread over several lines and indented, the same way libotr writes its files.
+// The value is followed by a newline.
+func Encode(w io.Writer, v Value) error {
+	bw := bufio.NewWriter(w)
+	if err := encodeValue(bw, v, ""); err != nil {
+		return err
+	}
+	if _, err := bw.WriteString("\n"); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// EncodeToString returns the encoded form of the given value, in the same format as Encode
+func EncodeToString(v Value) (string, error) {
+	var b strings.Builder
+	if err := Encode(&b, v); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func encodeValue(w *bufio.Writer, v Value, indent string) error {
+	switch vv := v.(type) {
+	case Snil:
+		_, err := w.WriteString("()")
+		return err
+	case Cons:
+		return encodeList(w, vv, indent)
+	default:
+		atom, err := encodeAtom(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.WriteString(atom)
+		return err
+	}
+}
+
+func encodeAtom(v Value) (string, error) {
+	switch vv := v.(type) {
+	case Symbol:
+		if isToken(string(vv)) {
+			return string(vv), nil
+		}
+		return quoteString(string(vv)), nil
+	case Sstring:
+		return quoteString(string(vv)), nil
+	case Octets:
+		return vv.String(), nil
+	case BigNum:
+		if vv.val == nil {
+			return "", errors.New("sexp: can't encode an empty bignum")
+		}
+		return vv.String(), nil
+	case nil:
+		return "", errors.New("sexp: can't encode a nil value")
+	default:
+		return "", fmt.Errorf("sexp: can't encode value of type %T", v)
+	}
+}
+
+func isList(v Value) bool {
+	switch v.(type) {
+	case Cons, Snil:
+		return true
+	}
+	return false
+}
+
+func listElements(l Cons) ([]Value, error) {
+	var result []Value
+	var current Value = l
+	for {
+		switch c := current.(type) {
+		case Snil:
+			return result, nil
+		case Cons:
+			result = append(result, c.first)
+			current = c.second
+		default:
+			return nil, errors.New("sexp: can't encode an improper list")
+		}
+	}
+}
+
+func encodeList(w *bufio.Writer, l Cons, indent string) error {
+	elements, err := listElements(l)
+	if err != nil {
+		return err
+	}
+
+	_, _ = w.WriteString("(")
+
+	head := 0
+	for head < len(elements) && !isList(elements[head]) {
+		if head > 0 {
+			_, _ = w.WriteString(" ")
+		}
+		if err := encodeValue(w, elements[head], indent); err != nil {
+			return err
+		}
+		head++
+	}
+
+	if head == len(elements) {
+		_, err := w.WriteString(")")
+		return err
+	}
+
+	inner := indent + encodeIndent
+	for _, e := range elements[head:] {
+		_, _ = w.WriteString("\n")
+		_, _ = w.WriteString(inner)
+		if err := encodeValue(w, e, inner); err != nil {
+			return err
+		}
+	}
+	_, _ = w.WriteString("\n")
+	_, _ = w.WriteString(indent)
+	_, err = w.WriteString(")")
+	return err
+}
+
+// isToken returns true if the given symbol can be written without quoting, following the libgcrypt rules for tokens
+func isToken(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isTokenCharacter(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isTokenCharacter(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.IndexByte("-./_:*+=", c) != -1
+}
+
+var stringEscapes = map[byte]string{
+	'"':  "\\\"",
+	'\\': "\\\\",
+	'\b': "\\b",
+	'\t': "\\t",
+	'\v': "\\v",
+	'\n': "\\n",
+	'\f': "\\f",
+	'\r': "\\r",
+}
+
+// quoteString returns the string quoted and escaped for use in an S-Expression
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if e, ok := stringEscapes[c]; ok {
+			b.WriteString(e)
+		} else if c < 0x20 || c == 0x7F {
+			b.WriteString(fmt.Sprintf("\\%03o", c))
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
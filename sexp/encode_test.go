@@ -0,0 +1,74 @@
+package sexp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_Encode_writesAnAtomFollowedByNewline(t *testing.T) {
+	b := new(bytes.Buffer)
+	err := Encode(b, Symbol("hello"))
+	assertEquals(t, err, nil)
+	assertEquals(t, b.String(), "hello\n")
+}
+
+func Test_Encode_writesAListOfAtomsOnOneLine(t *testing.T) {
+	res, err := EncodeToString(List(Symbol("p"), NewBigNum("ABCD"), Sstring("foo")))
+	assertEquals(t, err, nil)
+	assertEquals(t, res, "(p #ABCD# \"foo\")\n")
+}
+
+func Test_Encode_writesTheEmptyList(t *testing.T) {
+	res, _ := EncodeToString(List())
+	assertEquals(t, res, "()\n")
+}
+
+func Test_Encode_indentsNestedLists(t *testing.T) {
+	v := List(Symbol("privkeys"),
+		List(Symbol("account"),
+			List(Symbol("name"), Sstring("hello")),
+			List(Symbol("dsa"), List(Symbol("p"), NewBigNum("01")))))
+	res, _ := EncodeToString(v)
+	assertEquals(t, res, `(privkeys
+  (account
+    (name "hello")
+    (dsa
+      (p #1#)
+    )
+  )
+)
+`)
+}
+
+func Test_Encode_quotesSymbolsThatAreNotTokens(t *testing.T) {
+	res, _ := EncodeToString(List(Symbol("foo@example.com"), Symbol("prpl-jabber"), Symbol("1abc"), Symbol("")))
+	assertEquals(t, res, "(\"foo@example.com\" prpl-jabber \"1abc\" \"\")\n")
+}
+
+func Test_Encode_escapesStrings(t *testing.T) {
+	res, _ := EncodeToString(Sstring("a \"quoted\"\\ line\n\x01"))
+	assertEquals(t, res, "\"a \\\"quoted\\\"\\\\ line\\n\\001\"\n")
+}
+
+func Test_Encode_returnsErrorForNil(t *testing.T) {
+	_, err := EncodeToString(List(nil))
+	assertEquals(t, err.Error(), "sexp: can't encode a nil value")
+}
+
+func Test_Encode_returnsErrorForEmptyBigNum(t *testing.T) {
+	_, err := EncodeToString(NewBigNum("not hex"))
+	assertEquals(t, err.Error(), "sexp: can't encode an empty bignum")
+}
+
+func Test_Encode_returnsErrorForImproperList(t *testing.T) {
+	_, err := EncodeToString(Cons{Symbol("a"), Symbol("b")})
+	assertEquals(t, err.Error(), "sexp: can't encode an improper list")
+}
+
+func Test_Encode_canBeReadBack(t *testing.T) {
+	v := List(Symbol("account"),
+		List(Symbol("name"), Sstring("tricky \"name\"\t(with) stuff\\")),
+		List(Symbol("key"), NewBigNum("00FC07ABCF")))
+	res, _ := EncodeToString(v)
+	assertDeepEquals(t, Read(inp(res)), v)
+}
@@ -0,0 +1,23 @@
+package sexp
+
+import "testing"
+
+func FuzzRead(f *testing.F) {
+	f.Add("hello")
+	f.Add("\"hello\"")
+	f.Add("#123FFCADDD#")
+	f.Add("(an-atom (another-atom) (a-third))")
+	f.Add("(privkeys (account (name \"foo@example.com\") (protocol prpl-jabber) (private-key (dsa (p #00F24C#) (x #0D#)))))")
+	f.Add("(")
+	f.Add("#ABCD")
+	f.Add("(4:name|Zm9v|)")
+	f.Add("{KDM6YWJjKQ==}")
+
+	f.Fuzz(func(t *testing.T, data string) {
+		_, _ = Parse(inp(data))
+		res := Read(inp(data))
+		if res != nil {
+			_ = res.String()
+		}
+	})
+}
@@ -0,0 +1,342 @@
+package sexp
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+// Marshal returns the S-Expression representation of v.
+//
+// Structs are represented as a list of forms, one for each exported field that has a "sexp" tag.
+// The tag gives the name of the form, so a field tagged `sexp:"name"` with the value "foo" becomes (name "foo").
+// Strings become quoted strings, or symbols if the tag has the "symbol" option. *big.Int values become bignums,
+// Value fields are used as they are and nested structs are spliced into their form: (name (field1 ...) (field2 ...)).
+// A slice field generates one form for each element. Nil pointers, and empty values for fields with the
+// "omitempty" option, generate no form.
+func Marshal(v interface{}) (Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Type() == bigIntType || rv.Type().Implements(valueType) {
+		return marshalAtom(rv, fieldOptions{})
+	}
+
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("sexp: can't marshal nil %s", rv.Type())
+		}
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return marshalAtom(rv, fieldOptions{})
+	}
+	return marshalStruct(rv)
+}
+
+// MarshalForm returns the S-Expression representation of v inside a form with the given name, such as (name ...)
+func MarshalForm(name string, v interface{}) (Value, error) {
+	res, err := Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return Cons{Symbol(name), res}, nil
+}
+
+// Unmarshal stores the result of decoding the S-Expression v in the struct pointed to by out.
+// It follows the same rules as Marshal. Forms that don't correspond to any field are treated as errors,
+// while fields that have no form are left untouched. Strings, symbols and octets can be decoded into string fields,
+// and *big.Int fields can also be decoded from octets holding the big-endian bytes of the number,
+// which is how the canonical format represents them. Quoted strings are never decoded into *big.Int fields.
+func Unmarshal(v Value, out interface{}) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("sexp: can't unmarshal into non-pointer %T", out)
+	}
+	return unmarshalValue(v, rv.Elem(), "")
+}
+
+// UnmarshalForm decodes a form with the given name, such as (name ...), into the struct pointed to by out
+func UnmarshalForm(v Value, name string, out interface{}) error {
+	rest, ok := formContent(v, name)
+	if !ok {
+		return fmt.Errorf("sexp: expected form %s", name)
+	}
+
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("sexp: can't unmarshal into non-pointer %T", out)
+	}
+	return unmarshalValue(rest, rv.Elem(), name)
+}
+
+func formContent(v Value, name string) (Value, bool) {
+	c, ok := v.(Cons)
+	if !ok {
+		return nil, false
+	}
+	head, ok := formName(c.first)
+	if !ok || head != name {
+		return nil, false
+	}
+	return c.second, true
+}
+
+// formName returns the name of a form, which is a symbol in the advanced format but an octet string in the canonical format
+func formName(v Value) (string, bool) {
+	switch vv := v.(type) {
+	case Symbol:
+		return string(vv), true
+	case Octets:
+		return string(vv), true
+	}
+	return "", false
+}
+
+type fieldOptions struct {
+	name      string
+	symbol    bool
+	omitempty bool
+}
+
+func parseFieldTag(tag string) fieldOptions {
+	parts := strings.Split(tag, ",")
+	res := fieldOptions{name: parts[0]}
+	for _, p := range parts[1:] {
+		switch p {
+		case "symbol":
+			res.symbol = true
+		case "omitempty":
+			res.omitempty = true
+		}
+	}
+	return res
+}
+
+type taggedField struct {
+	index int
+	opts  fieldOptions
+}
+
+func taggedFields(t reflect.Type) []taggedField {
+	var result []taggedField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("sexp")
+		if !ok || tag == "-" || f.PkgPath != "" {
+			continue
+		}
+		opts := parseFieldTag(tag)
+		if opts.name == "" {
+			opts.name = f.Name
+		}
+		result = append(result, taggedField{i, opts})
+	}
+	return result
+}
+
+var (
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+	valueType  = reflect.TypeOf((*Value)(nil)).Elem()
+)
+
+func marshalStruct(rv reflect.Value) (Value, error) {
+	var forms []Value
+	for _, f := range taggedFields(rv.Type()) {
+		fv := rv.Field(f.index)
+		if f.opts.omitempty && fv.IsZero() {
+			continue
+		}
+
+		values := []reflect.Value{fv}
+		if fv.Kind() == reflect.Slice {
+			values = nil
+			for i := 0; i < fv.Len(); i++ {
+				values = append(values, fv.Index(i))
+			}
+		}
+
+		for _, v := range values {
+			form, err := marshalField(f.opts, v)
+			if err != nil {
+				return nil, err
+			}
+			if form != nil {
+				forms = append(forms, form)
+			}
+		}
+	}
+	return List(forms...), nil
+}
+
+// marshalField returns the form for one field value, or nil if the value should be skipped
+func marshalField(opts fieldOptions, v reflect.Value) (Value, error) {
+	name := Symbol(opts.name)
+	if v.Type() != bigIntType && v.Type() != valueType {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil, nil
+			}
+			v = v.Elem()
+		}
+
+		if v.Kind() == reflect.Struct && !v.Type().Implements(valueType) {
+			forms, err := marshalStruct(v)
+			if err != nil {
+				return nil, err
+			}
+			return Cons{name, forms}, nil
+		}
+	} else if v.IsNil() {
+		return nil, nil
+	}
+
+	res, err := marshalAtom(v, opts)
+	if err != nil {
+		return nil, err
+	}
+	return List(name, res), nil
+}
+
+func marshalAtom(v reflect.Value, opts fieldOptions) (Value, error) {
+	switch {
+	case v.Type() == bigIntType:
+		return BigNum{new(big.Int).Set(v.Interface().(*big.Int))}, nil
+	case v.Type() == valueType:
+		return v.Interface().(Value), nil
+	case v.Type().Implements(valueType):
+		return v.Interface().(Value), nil
+	case v.Kind() == reflect.String:
+		if opts.symbol {
+			return Symbol(v.String()), nil
+		}
+		return Sstring(v.String()), nil
+	}
+	return nil, fmt.Errorf("sexp: can't marshal value of type %s", v.Type())
+}
+
+func unmarshalValue(forms Value, rv reflect.Value, path string) error {
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("sexp: can't unmarshal into %s", rv.Type())
+	}
+
+	fields := taggedFields(rv.Type())
+	for {
+		c, ok := forms.(Cons)
+		if !ok {
+			return nil
+		}
+		forms = c.second
+
+		form, ok := c.first.(Cons)
+		if !ok {
+			return fmt.Errorf("sexp: expected a form in %s, got %v", describePath(path), c.first)
+		}
+		name, ok := formName(form.first)
+		if !ok {
+			return fmt.Errorf("sexp: expected a form name in %s, got %v", describePath(path), form.first)
+		}
+
+		f, ok := findField(fields, name)
+		if !ok {
+			return fmt.Errorf("sexp: unexpected form %s in %s", name, describePath(path))
+		}
+
+		fv := rv.Field(f.index)
+		if err := unmarshalField(form.second, fv, joinPath(path, name)); err != nil {
+			return err
+		}
+	}
+}
+
+func findField(fields []taggedField, name string) (taggedField, bool) {
+	for _, f := range fields {
+		if f.opts.name == name {
+			return f, true
+		}
+	}
+	return taggedField{}, false
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func describePath(path string) string {
+	if path == "" {
+		return "top level"
+	}
+	return path
+}
+
+func unmarshalField(content Value, fv reflect.Value, path string) error {
+	if fv.Kind() == reflect.Slice {
+		elem := reflect.New(fv.Type().Elem()).Elem()
+		if err := unmarshalField(content, elem, path); err != nil {
+			return err
+		}
+		fv.Set(reflect.Append(fv, elem))
+		return nil
+	}
+
+	if fv.Type() != bigIntType && fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		return unmarshalField(content, fv.Elem(), path)
+	}
+
+	if fv.Kind() == reflect.Struct && !fv.Type().Implements(valueType) {
+		return unmarshalValue(content, fv, path)
+	}
+
+	c, ok := content.(Cons)
+	if !ok {
+		return fmt.Errorf("sexp: expected a value for %s", path)
+	}
+	if _, ok := c.second.(Snil); !ok {
+		return fmt.Errorf("sexp: expected only one value for %s", path)
+	}
+	return unmarshalAtom(c.first, fv, path)
+}
+
+func unmarshalAtom(v Value, fv reflect.Value, path string) error {
+	switch {
+	case fv.Type() == bigIntType:
+		if b, ok := v.(BigNum); ok && b.val != nil {
+			fv.Set(reflect.ValueOf(new(big.Int).Set(b.val)))
+			return nil
+		}
+		if s, ok := v.(Octets); ok && len(s) > 0 {
+			fv.Set(reflect.ValueOf(new(big.Int).SetBytes([]byte(s))))
+			return nil
+		}
+		return fmt.Errorf("sexp: expected a bignum for %s, got %v", path, v)
+	case fv.Type() == valueType:
+		fv.Set(reflect.ValueOf(&v).Elem())
+		return nil
+	case fv.Type().Implements(valueType):
+		if v != nil && reflect.TypeOf(v).AssignableTo(fv.Type()) {
+			fv.Set(reflect.ValueOf(v))
+			return nil
+		}
+		return fmt.Errorf("sexp: expected a %s for %s, got %v", fv.Type(), path, v)
+	case fv.Kind() == reflect.String:
+		switch vv := v.(type) {
+		case Sstring:
+			fv.SetString(string(vv))
+			return nil
+		case Symbol:
+			fv.SetString(string(vv))
+			return nil
+		case Octets:
+			fv.SetString(string(vv))
+			return nil
+		}
+		return fmt.Errorf("sexp: expected a string or symbol for %s, got %v", path, v)
+	}
+	return fmt.Errorf("sexp: can't unmarshal into %s for %s", fv.Type(), path)
+}
@@ -0,0 +1,147 @@
+package sexp
+
+import (
+	"math/big"
+	"testing"
+)
+
+type marshalTestParameters struct {
+	P *big.Int `sexp:"p"`
+	Q *big.Int `sexp:"q,omitempty"`
+}
+
+type marshalTestAccount struct {
+	Name       string                 `sexp:"name"`
+	Protocol   string                 `sexp:"protocol,symbol"`
+	Parameters *marshalTestParameters `sexp:"dsa"`
+	Extra      Value                  `sexp:"extra"`
+	Ignored    string
+}
+
+type marshalTestFile struct {
+	Accounts []marshalTestAccount `sexp:"account"`
+}
+
+func Test_Marshal_marshalsAStructIntoForms(t *testing.T) {
+	v, err := Marshal(marshalTestAccount{
+		Name:       "foo",
+		Protocol:   "prpl-jabber",
+		Parameters: &marshalTestParameters{P: big.NewInt(0xAB)},
+		Ignored:    "something",
+	})
+	assertEquals(t, err, nil)
+	assertDeepEquals(t, v, List(
+		List(Symbol("name"), Sstring("foo")),
+		List(Symbol("protocol"), Symbol("prpl-jabber")),
+		List(Symbol("dsa"), List(Symbol("p"), NewBigNum("AB"))),
+	))
+}
+
+func Test_MarshalForm_generatesOneFormPerSliceElement(t *testing.T) {
+	v, err := MarshalForm("privkeys", marshalTestFile{
+		Accounts: []marshalTestAccount{{Name: "one", Protocol: "a"}, {Name: "two", Protocol: "b", Extra: Symbol("x")}},
+	})
+	assertEquals(t, err, nil)
+	res, _ := EncodeToString(v)
+	assertEquals(t, res, `(privkeys
+  (account
+    (name "one")
+    (protocol a)
+  )
+  (account
+    (name "two")
+    (protocol b)
+    (extra x)
+  )
+)
+`)
+}
+
+func Test_Marshal_marshalsAtoms(t *testing.T) {
+	v, _ := Marshal("hello")
+	assertEquals(t, v, Sstring("hello"))
+	v, _ = Marshal(Symbol("hello"))
+	assertEquals(t, v, Symbol("hello"))
+	v, _ = Marshal(big.NewInt(10))
+	assertDeepEquals(t, v, NewBigNum("A"))
+}
+
+func Test_Marshal_returnsErrorForUnsupportedTypes(t *testing.T) {
+	_, err := Marshal(struct {
+		A int `sexp:"a"`
+	}{42})
+	assertEquals(t, err.Error(), "sexp: can't marshal value of type int")
+}
+
+func Test_Unmarshal_isTheInverseOfMarshal(t *testing.T) {
+	orig := marshalTestFile{
+		Accounts: []marshalTestAccount{
+			{Name: "one", Protocol: "a", Parameters: &marshalTestParameters{P: big.NewInt(1), Q: big.NewInt(2)}},
+			{Name: "two", Protocol: "b", Extra: List(Symbol("x"))},
+		},
+	}
+	v, _ := MarshalForm("privkeys", orig)
+	s, _ := EncodeToString(v)
+
+	var res marshalTestFile
+	err := UnmarshalForm(Read(inp(s)), "privkeys", &res)
+	assertEquals(t, err, nil)
+	assertDeepEquals(t, res, orig)
+}
+
+func Test_Unmarshal_acceptsStringsAndSymbolsForStrings(t *testing.T) {
+	var res marshalTestAccount
+	err := Unmarshal(Read(inp(`((name foo) (protocol "bar"))`)), &res)
+	assertEquals(t, err, nil)
+	assertEquals(t, res.Name, "foo")
+	assertEquals(t, res.Protocol, "bar")
+}
+
+func Test_Unmarshal_returnsErrorForUnknownForms(t *testing.T) {
+	var res marshalTestFile
+	err := UnmarshalForm(Read(inp(`(privkeys (account (dsa (px #AB#))))`)), "privkeys", &res)
+	assertEquals(t, err.Error(), "sexp: unexpected form px in privkeys.account.dsa")
+}
+
+func Test_Unmarshal_returnsErrorForWrongValueTypes(t *testing.T) {
+	var res marshalTestAccount
+	err := Unmarshal(Read(inp(`((dsa (p "AB")))`)), &res)
+	assertEquals(t, err.Error(), "sexp: expected a bignum for dsa.p, got \"AB\"")
+}
+
+func Test_Unmarshal_returnsErrorForTooManyValues(t *testing.T) {
+	var res marshalTestAccount
+	err := Unmarshal(Read(inp(`((name "a" "b"))`)), &res)
+	assertEquals(t, err.Error(), "sexp: expected only one value for name")
+}
+
+func Test_Unmarshal_returnsErrorForNonForms(t *testing.T) {
+	var res marshalTestAccount
+	err := Unmarshal(Read(inp(`(name)`)), &res)
+	assertEquals(t, err.Error(), "sexp: expected a form in top level, got name")
+}
+
+func Test_Unmarshal_returnsErrorForNonPointer(t *testing.T) {
+	err := Unmarshal(List(), marshalTestAccount{})
+	assertEquals(t, err.Error(), "sexp: can't unmarshal into non-pointer sexp.marshalTestAccount")
+}
+
+func Test_UnmarshalForm_returnsErrorForTheWrongForm(t *testing.T) {
+	var res marshalTestFile
+	err := UnmarshalForm(Read(inp(`(pubkeys)`)), "privkeys", &res)
+	assertEquals(t, err.Error(), "sexp: expected form privkeys")
+}
+
+func Test_Unmarshal_canUnmarshalIntoSpecificValueTypes(t *testing.T) {
+	var res struct {
+		Sym Symbol `sexp:"sym"`
+		Num BigNum `sexp:"num"`
+	}
+	err := Unmarshal(Read(inp(`((sym foo) (num #AB#))`)), &res)
+	assertEquals(t, err, nil)
+	assertEquals(t, res.Sym, Symbol("foo"))
+	assertDeepEquals(t, res.Num, NewBigNum("AB"))
+
+	err = Unmarshal(Read(inp(`((sym "foo"))`)), &res)
+	assertEquals(t, err.Error(), "sexp: expected a sexp.Symbol for sym, got \"foo\"")
+}
@@ -0,0 +1,27 @@
+package sexp
+
+import "encoding/base64"
+
+// Octets represents an S-Expression octet string written in the canonical or transport format, or in base64.
+// Contrary to Sstring, it can hold the bytes of a number, since that is how the canonical format writes bignums.
+type Octets string
+
+// First will fail if called on Octets
+func (s Octets) First() Value {
+	panic("not valid to call First on Octets")
+}
+
+// Second will fail if called on Octets
+func (s Octets) Second() Value {
+	panic("not valid to call Second on Octets")
+}
+
+// String returns the octets in base64, such as |YWJj|
+func (s Octets) String() string {
+	return "|" + base64.StdEncoding.EncodeToString([]byte(s)) + "|"
+}
+
+// Value returns the octets as a string
+func (s Octets) Value() interface{} {
+	return string(s)
+}
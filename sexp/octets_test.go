@@ -0,0 +1,30 @@
+package sexp
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Octets_First_generatesAPanic(t *testing.T) {
+	defer checkForPanic(t, "not valid to call First on Octets")
+	Octets("ABCD").First()
+}
+
+func Test_Octets_Second_generatesAPanic(t *testing.T) {
+	defer checkForPanic(t, "not valid to call Second on Octets")
+	Octets("ABCD").Second()
+}
+
+func Test_Octets_Value_returnsTheStringRepresentation(t *testing.T) {
+	assertDeepEquals(t, Octets("ABB").Value(), "ABB")
+}
+
+func Test_Octets_String_returnsTheOctetsInBase64(t *testing.T) {
+	assertEquals(t, Octets("foobar").String(), "|Zm9vYmFy|")
+}
+
+func Test_Octets_String_canBeParsedAgain(t *testing.T) {
+	res, err := Parse(strings.NewReader(Octets("\x00\x80)").String()))
+	assertEquals(t, err, nil)
+	assertEquals(t, res, Octets("\x00\x80)"))
+}
@@ -0,0 +1,204 @@
+package sexp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// ParseError describes a malformed S-Expression, and where in the input the problem was found.
+// Line and Column both start at 1.
+type ParseError struct {
+	Line     int
+	Column   int
+	Expected string
+	Found    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("sexp: line %d, column %d: expected %s, found %s", e.Line, e.Column, e.Expected, e.Found)
+}
+
+// Parse will read one S-Expression from the given reader. Contrary to Read, it will return
+// a *ParseError pointing to the first problem found if the input is not a well formed S-Expression.
+// Besides the advanced format, Parse understands the canonical and transport formats of libgcrypt:
+// length prefixed octet strings such as 3:abc, base64 octet strings such as |YWJj| and base64
+// encoded canonical expressions such as {KDM6YWJjKQ==}. All of these octet strings are read as Octets.
+func Parse(r io.Reader) (Value, error) {
+	p := newParser(r)
+	return p.value()
+}
+
+type position struct {
+	line, column int
+}
+
+// parser reads bytes while keeping track of the line and column of the next byte to read
+type parser struct {
+	r    *bufio.Reader
+	pos  position
+	prev position
+}
+
+func newParser(r io.Reader) *parser {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &parser{r: br, pos: position{1, 1}}
+}
+
+// ReadByte implements io.ByteReader
+func (p *parser) ReadByte() (byte, error) {
+	c, err := p.r.ReadByte()
+	if err != nil {
+		return c, err
+	}
+	p.prev = p.pos
+	if c == '\n' {
+		p.pos = position{p.pos.line + 1, 1}
+	} else {
+		p.pos.column++
+	}
+	return c, nil
+}
+
+// UnreadByte implements io.ByteScanner
+func (p *parser) UnreadByte() error {
+	if err := p.r.UnreadByte(); err != nil {
+		return err
+	}
+	p.pos = p.prev
+	return nil
+}
+
+func (p *parser) errorAt(pos position, expected, found string) error {
+	return &ParseError{Line: pos.line, Column: pos.column, Expected: expected, Found: found}
+}
+
+// unexpected returns an error for the next byte in the input, without consuming it
+func (p *parser) unexpected(expected string) error {
+	c, err := peek(p)
+	if err != nil {
+		return p.errorAt(p.pos, expected, "end of input")
+	}
+	return p.errorAt(p.pos, expected, fmt.Sprintf("%q", c))
+}
+
+func (p *parser) skipWhitespace() {
+	c, err := peek(p)
+	for err == nil && isWhitespace(c) {
+		_, _ = p.ReadByte()
+		c, err = peek(p)
+	}
+}
+
+func (p *parser) value() (Value, error) {
+	p.skipWhitespace()
+	c, err := peek(p)
+	if err != nil {
+		return nil, p.unexpected("a value")
+	}
+	switch c {
+	case '(':
+		return p.list()
+	case ')':
+		return nil, p.unexpected("a value")
+	case '"':
+		return p.str()
+	case '#':
+		return p.bignum()
+	case '|':
+		return p.base64String()
+	case '{':
+		return p.transport()
+	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return p.verbatim()
+	default:
+		return p.symbol(), nil
+	}
+}
+
+func (p *parser) symbol() Value {
+	var result []byte
+	c, err := peek(p)
+	for err == nil && !isNotSymbolCharacter(c) {
+		_, _ = p.ReadByte()
+		result = append(result, c)
+		c, err = peek(p)
+	}
+	return Symbol(result)
+}
+
+func (p *parser) expect(c byte) error {
+	res, err := peek(p)
+	if err != nil || res != c {
+		return p.unexpected(fmt.Sprintf("%q", c))
+	}
+	_, _ = p.ReadByte()
+	return nil
+}
+
+func (p *parser) list() (Value, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+
+	var values []Value
+	for {
+		p.skipWhitespace()
+		c, err := peek(p)
+		if err != nil {
+			return nil, p.unexpected("')'")
+		}
+		if c == ')' {
+			_, _ = p.ReadByte()
+			return List(values...), nil
+		}
+
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+}
+
+func (p *parser) str() (Value, error) {
+	if err := p.expect('"'); err != nil {
+		return nil, err
+	}
+	start := p.pos
+	result, ok := readEscapedDataUntilQuote(p)
+	if !ok {
+		return nil, p.errorAt(start, "a valid escape sequence", "a malformed string")
+	}
+	if err := p.expect('"'); err != nil {
+		return nil, err
+	}
+	return Sstring(result), nil
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func (p *parser) bignum() (Value, error) {
+	if err := p.expect('#'); err != nil {
+		return nil, err
+	}
+
+	var result []byte
+	for {
+		c, err := peek(p)
+		if err == nil && c == '#' && len(result) > 0 {
+			_, _ = p.ReadByte()
+			return NewBigNum(string(result)), nil
+		}
+		if err != nil || !isHexDigit(c) {
+			return nil, p.unexpected("a hexadecimal digit")
+		}
+		_, _ = p.ReadByte()
+		result = append(result, c)
+	}
+}
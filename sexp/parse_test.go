@@ -0,0 +1,59 @@
+package sexp
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Parse_willParseAnExpression(t *testing.T) {
+	result, err := Parse(strings.NewReader(`(an-atom "a string" #00FF# (nested))`))
+	assertEquals(t, err, nil)
+	assertDeepEquals(t, result, List(Symbol("an-atom"), Sstring("a string"), NewBigNum("00FF"), List(Symbol("nested"))))
+}
+
+func Test_Parse_willParseAnEmptyList(t *testing.T) {
+	result, err := Parse(strings.NewReader(" ()"))
+	assertEquals(t, err, nil)
+	assertDeepEquals(t, result, List())
+}
+
+func Test_Parse_willReturnAnErrorForAnUnclosedList(t *testing.T) {
+	_, err := Parse(strings.NewReader("(privkeys\n  (account\n"))
+	assertDeepEquals(t, err, &ParseError{Line: 3, Column: 1, Expected: "')'", Found: "end of input"})
+	assertEquals(t, err.Error(), "sexp: line 3, column 1: expected ')', found end of input")
+}
+
+func Test_Parse_willReturnAnErrorForAnUnexpectedListEnd(t *testing.T) {
+	_, err := Parse(strings.NewReader(")"))
+	assertDeepEquals(t, err, &ParseError{Line: 1, Column: 1, Expected: "a value", Found: "')'"})
+}
+
+func Test_Parse_willReturnAnErrorForEmptyInput(t *testing.T) {
+	_, err := Parse(strings.NewReader("  "))
+	assertDeepEquals(t, err, &ParseError{Line: 1, Column: 3, Expected: "a value", Found: "end of input"})
+}
+
+func Test_Parse_willReturnAnErrorForAnInvalidBigNum(t *testing.T) {
+	_, err := Parse(strings.NewReader("(p\n  #00FG#)"))
+	assertDeepEquals(t, err, &ParseError{Line: 2, Column: 7, Expected: "a hexadecimal digit", Found: "'G'"})
+}
+
+func Test_Parse_willReturnAnErrorForAnEmptyBigNum(t *testing.T) {
+	_, err := Parse(strings.NewReader("##"))
+	assertDeepEquals(t, err, &ParseError{Line: 1, Column: 2, Expected: "a hexadecimal digit", Found: "'#'"})
+}
+
+func Test_Parse_willReturnAnErrorForAnUnterminatedBigNum(t *testing.T) {
+	_, err := Parse(strings.NewReader("#00"))
+	assertDeepEquals(t, err, &ParseError{Line: 1, Column: 4, Expected: "a hexadecimal digit", Found: "end of input"})
+}
+
+func Test_Parse_willReturnAnErrorForAnUnterminatedString(t *testing.T) {
+	_, err := Parse(strings.NewReader(`(name "foo`))
+	assertDeepEquals(t, err, &ParseError{Line: 1, Column: 11, Expected: "'\"'", Found: "end of input"})
+}
+
+func Test_Parse_willReturnAnErrorForAMalformedEscape(t *testing.T) {
+	_, err := Parse(strings.NewReader(`"fo\q"`))
+	assertDeepEquals(t, err, &ParseError{Line: 1, Column: 2, Expected: "a valid escape sequence", Found: "a malformed string"})
+}
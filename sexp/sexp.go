@@ -13,7 +13,7 @@ type Value interface {
 	String() string
 }
 
-func peek(r *bufio.Reader) (c byte, e error) {
+func peek(r io.ByteScanner) (c byte, e error) {
 	c, e = r.ReadByte()
 	if e != io.EOF {
 		_ = r.UnreadByte()
@@ -81,11 +81,15 @@ func isNotSymbolCharacter(c byte) bool {
 func expect(r *bufio.Reader, c byte) bool {
 	ReadWhitespace(r)
 	res, err := r.ReadByte()
+	if err != nil {
+		return false
+	}
+
 	if res != c {
 		_ = r.UnreadByte()
 	}
 
-	return res == c && err != io.EOF
+	return res == c
 }
 
 func untilFixed(b byte) func(byte) bool {
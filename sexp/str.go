@@ -1,6 +1,10 @@
 package sexp
 
-import "bufio"
+import (
+	"bufio"
+	"io"
+	"strconv"
+)
 
 // Sstring represents an S-Expression symbol.
 type Sstring string
@@ -15,9 +19,9 @@ func (s Sstring) Second() Value {
 	panic("not valid to call Second on an SString")
 }
 
-// String returns the string quoted as a string in an S-Expression
+// String returns the string quoted and escaped as a string in an S-Expression
 func (s Sstring) String() string {
-	return "\"" + string(s) + "\""
+	return quoteString(string(s))
 }
 
 // Value returns the string as a string
@@ -41,9 +45,76 @@ func ReadString(r *bufio.Reader) Value {
 	if !ReadStringStart(r) {
 		return nil
 	}
-	result := ReadDataUntil(r, untilFixed('"'))
-	if !ReadStringEnd(r) {
+	result, ok := readEscapedDataUntilQuote(r)
+	if !ok || !ReadStringEnd(r) {
 		return nil
 	}
 	return Sstring(result)
 }
+
+var stringUnescapes = map[byte]byte{
+	'"':  '"',
+	'\'': '\'',
+	'\\': '\\',
+	'b':  '\b',
+	't':  '\t',
+	'v':  '\v',
+	'n':  '\n',
+	'f':  '\f',
+	'r':  '\r',
+}
+
+// readEscapedDataUntilQuote reads the content of a quoted string, resolving the escape sequences libgcrypt understands
+func readEscapedDataUntilQuote(r io.ByteScanner) ([]byte, bool) {
+	result := make([]byte, 0, 10)
+	for {
+		c, err := peek(r)
+		if err != nil || c == '"' {
+			return result, true
+		}
+		_, _ = r.ReadByte()
+		if c != '\\' {
+			result = append(result, c)
+			continue
+		}
+
+		c, err = r.ReadByte()
+		if err != nil {
+			return nil, false
+		}
+
+		switch {
+		case stringUnescapes[c] != 0:
+			result = append(result, stringUnescapes[c])
+		case c >= '0' && c <= '7':
+			v, ok := readEscapedNumber(r, c, 3, 8)
+			if !ok {
+				return nil, false
+			}
+			result = append(result, v)
+		case c == 'x':
+			v, ok := readEscapedNumber(r, '0', 3, 16)
+			if !ok {
+				return nil, false
+			}
+			result = append(result, v)
+		case c == '\n':
+			// A line continuation, the newline is not part of the string
+		default:
+			return nil, false
+		}
+	}
+}
+
+func readEscapedNumber(r io.ByteScanner, first byte, digits int, base int) (byte, bool) {
+	buf := []byte{first}
+	for len(buf) < digits {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, false
+		}
+		buf = append(buf, c)
+	}
+	v, err := strconv.ParseUint(string(buf), base, 8)
+	return byte(v), err == nil
+}
@@ -35,3 +35,19 @@ func Test_ReadString_returnsNilIfAskedToReadNonFinishedString(t *testing.T) {
 	res := ReadString(bufio.NewReader(bytes.NewReader([]byte("\"a"))))
 	assertEquals(t, res, nil)
 }
+
+func Test_Sstring_String_escapesTheString(t *testing.T) {
+	res := Sstring("A\"B\n").String()
+	assertDeepEquals(t, res, "\"A\\\"B\\n\"")
+}
+
+func Test_ReadString_resolvesEscapes(t *testing.T) {
+	res := ReadString(bufio.NewReader(bytes.NewReader([]byte(`"a\"b\\c\n\101\x42\
+d"`))))
+	assertEquals(t, res, Sstring("a\"b\\c\nABd"))
+}
+
+func Test_ReadString_returnsNilForInvalidEscapes(t *testing.T) {
+	res := ReadString(bufio.NewReader(bytes.NewReader([]byte(`"a\qb"`))))
+	assertEquals(t, res, nil)
+}
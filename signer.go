@@ -0,0 +1,276 @@
+package otr3
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Signer creates signatures with a long-term key that is held outside of this process,
+// for example by a separate signing process or a hardware token. Sign receives the already hashed data,
+// and should return the signature in the same format as the corresponding PrivateKey would.
+type Signer interface {
+	PublicKey() PublicKey
+	Sign(hashed []byte) ([]byte, error)
+}
+
+var errSignerKeyHasNoPrivateMaterial = newOtrError("the private key is held by an external signer")
+
+// SignerKey is a PrivateKey that delegates all signing to a Signer. It can be given to SetOurKeys like any other
+// key, and the signatures needed during the AKE will then be created by the Signer, so the private key
+// never has to be loaded into the memory of this process.
+type SignerKey struct {
+	Signer Signer
+}
+
+// NewSignerKey returns a PrivateKey that uses the given Signer to create signatures
+func NewSignerKey(s Signer) *SignerKey {
+	return &SignerKey{Signer: s}
+}
+
+// Parse will always fail, since the private key material is held by the Signer
+func (k *SignerKey) Parse(in []byte) ([]byte, bool) {
+	return in, false
+}
+
+// Serialize returns nil, since the private key material is held by the Signer
+func (k *SignerKey) Serialize() []byte {
+	return nil
+}
+
+// Sign will ask the Signer to sign the hashed data. The random source is not used, since the Signer has its own.
+func (k *SignerKey) Sign(_ io.Reader, hashed []byte) ([]byte, error) {
+	return k.Signer.Sign(hashed)
+}
+
+// Generate will always fail, since keys have to be generated by the Signer itself
+func (k *SignerKey) Generate(io.Reader) error {
+	return errSignerKeyHasNoPrivateMaterial
+}
+
+// PublicKey returns the public key of the Signer
+func (k *SignerKey) PublicKey() PublicKey {
+	return k.Signer.PublicKey()
+}
+
+// IsAvailableForVersion returns true if the public key of the Signer can be used with the given version
+func (k *SignerKey) IsAvailableForVersion(v uint16) bool {
+	pub, ok := k.Signer.PublicKey().(*DSAPublicKey)
+	return ok && pub.IsAvailableForVersion(v)
+}
+
+// The signer protocol is a simple request and response protocol over a stream. Every frame starts
+// with a WORD containing the length of the rest of the frame. A request is a BYTE with the operation
+// followed by DATA with the hashed data to sign, if any. A response is a BYTE with the status followed
+// by DATA holding either the serialized public key, the signature or an error message.
+const (
+	signerOpPublicKey byte = 0x01
+	signerOpSign      byte = 0x02
+
+	signerStatusOK    byte = 0x00
+	signerStatusError byte = 0x01
+
+	signerMaxFrameSize = 1 << 16
+
+	// defaultSignerTimeout is how long a RemoteSigner waits for an answer, unless SetTimeout is called
+	defaultSignerTimeout = 30 * time.Second
+)
+
+var errSignerProtocol = newOtrError("malformed message in signer protocol")
+var errSignerClosed = newOtrError("the connection to the signer was closed")
+var errSignerTimeout = newOtrError("the signer didn't answer in time")
+var errSignerBroken = newOtrError("the connection to the signer can't be used after an earlier error")
+
+func writeSignerFrame(w io.Writer, kind byte, data []byte) error {
+	payload := AppendData([]byte{kind}, data)
+	_, err := w.Write(AppendWord(nil, uint32(len(payload))))
+	if err == nil {
+		_, err = w.Write(payload)
+	}
+	return err
+}
+
+func readSignerFrame(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	_, l, _ := ExtractWord(header)
+	if l > signerMaxFrameSize {
+		return 0, nil, errSignerProtocol
+	}
+
+	payload := make([]byte, l)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+
+	rest, kind, ok1 := ExtractByte(payload)
+	_, data, ok2 := ExtractData(rest)
+	if !ok1 || !ok2 {
+		return 0, nil, errSignerProtocol
+	}
+	return kind, data, nil
+}
+
+// ServeSigner answers signing requests arriving on the given stream using the private key, until the stream is closed.
+// It is meant to run in the separate process that holds the key, with the other end of the stream given to NewRemoteSigner.
+func ServeSigner(rw io.ReadWriter, key PrivateKey, rand io.Reader) error {
+	for {
+		op, data, err := readSignerFrame(rw)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch op {
+		case signerOpPublicKey:
+			err = writeSignerFrame(rw, signerStatusOK, key.PublicKey().serialize())
+		case signerOpSign:
+			sig, e := key.Sign(rand, data)
+			if e != nil {
+				err = writeSignerFrame(rw, signerStatusError, []byte(e.Error()))
+			} else {
+				err = writeSignerFrame(rw, signerStatusOK, sig)
+			}
+		default:
+			err = writeSignerFrame(rw, signerStatusError, []byte("unknown operation"))
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// RemoteSigner is a Signer that sends its requests over a stream to a process running ServeSigner.
+// If the stream supports deadlines, like a net.Conn does, every request fails when the signer doesn't answer in time.
+// After a request fails because of the stream, the stream can't be trusted to be in sync anymore,
+// so all later requests fail as well.
+type RemoteSigner struct {
+	lock    sync.Mutex
+	rw      io.ReadWriter
+	pub     PublicKey
+	timeout time.Duration
+	broken  bool
+}
+
+// NewRemoteSigner asks the signing process on the other end of the stream for its public key,
+// and returns a Signer that will send all signing requests to it
+func NewRemoteSigner(rw io.ReadWriter) (*RemoteSigner, error) {
+	s := &RemoteSigner{rw: rw, timeout: defaultSignerTimeout}
+	data, err := s.request(signerOpPublicKey, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	_, ok, pub := ParsePublicKey(data)
+	if !ok {
+		return nil, errSignerProtocol
+	}
+	s.pub = pub
+	return s, nil
+}
+
+// DialSigner connects to a signing process listening on the given network address, such as a unix socket
+func DialSigner(network, address string) (*RemoteSigner, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewRemoteSigner(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// SetTimeout sets how long to wait for the signing process to answer a request. A timeout of zero means waiting forever.
+// It only has an effect if the stream supports deadlines.
+func (s *RemoteSigner) SetTimeout(d time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.timeout = d
+}
+
+func (s *RemoteSigner) setDeadline(t time.Time) {
+	if d, ok := s.rw.(interface{ SetDeadline(time.Time) error }); ok {
+		_ = d.SetDeadline(t)
+	}
+}
+
+func (s *RemoteSigner) request(op byte, data []byte) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.broken {
+		return nil, errSignerBroken
+	}
+
+	if s.timeout > 0 {
+		s.setDeadline(time.Now().Add(s.timeout))
+		defer s.setDeadline(time.Time{})
+	}
+
+	err := writeSignerFrame(s.rw, op, data)
+	var status byte
+	var res []byte
+	if err == nil {
+		status, res, err = readSignerFrame(s.rw)
+	}
+	if err != nil {
+		s.broken = true
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return nil, errSignerTimeout
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF || err == io.ErrClosedPipe {
+		return nil, errSignerClosed
+	}
+	if err != nil {
+		return nil, err
+	}
+	if status != signerStatusOK {
+		return nil, newOtrErrorf("signer failed: %s", res)
+	}
+	return res, nil
+}
+
+// PublicKey returns the public key of the signing process
+func (s *RemoteSigner) PublicKey() PublicKey {
+	return s.pub
+}
+
+// Sign asks the signing process to sign the hashed data
+func (s *RemoteSigner) Sign(hashed []byte) ([]byte, error) {
+	return s.request(signerOpSign, hashed)
+}
+
+// Close closes the stream to the signing process, if it can be closed
+func (s *RemoteSigner) Close() error {
+	if c, ok := s.rw.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// NewLoopbackSigner is a reference implementation of the signer protocol, that serves the given key
+// over an in-memory connection. It is mostly useful for testing, since the key stays in this process.
+func NewLoopbackSigner(key PrivateKey, rand io.Reader) (*RemoteSigner, error) {
+	client, server := net.Pipe()
+	go func() {
+		_ = ServeSigner(server, key, rand)
+		_ = server.Close()
+	}()
+
+	s, err := NewRemoteSigner(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return s, nil
+}
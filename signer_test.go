@@ -0,0 +1,146 @@
+package otr3
+
+import (
+	"bytes"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+)
+
+func Test_NewLoopbackSigner_fetchesThePublicKeyOfTheServedKey(t *testing.T) {
+	s, err := NewLoopbackSigner(alicePrivateKey, rand.Reader)
+	assertNil(t, err)
+	defer s.Close()
+
+	assertDeepEquals(t, s.PublicKey().Fingerprint(), alicePrivateKey.PublicKey().Fingerprint())
+}
+
+func Test_RemoteSigner_createsSignaturesThatCanBeVerified(t *testing.T) {
+	s, _ := NewLoopbackSigner(alicePrivateKey, rand.Reader)
+	defer s.Close()
+
+	hashed := bytes.Repeat([]byte{0x42}, 20)
+	sig, err := s.Sign(hashed)
+	assertNil(t, err)
+
+	_, ok := alicePrivateKey.PublicKey().Verify(hashed, sig)
+	assertEquals(t, ok, true)
+}
+
+func Test_RemoteSigner_returnsTheErrorFromTheSigningProcess(t *testing.T) {
+	s, _ := NewLoopbackSigner(alicePrivateKey, fixedRand([]string{}))
+	defer s.Close()
+
+	_, err := s.Sign(bytes.Repeat([]byte{0x42}, 20))
+	assertEquals(t, err, newOtrError("signer failed: EOF"))
+}
+
+func Test_RemoteSigner_returnsAnErrorIfTheSigningProcessIsGone(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		_ = ServeSigner(server, alicePrivateKey, rand.Reader)
+	}()
+	s, _ := NewRemoteSigner(client)
+	_ = server.Close()
+
+	_, err := s.Sign(bytes.Repeat([]byte{0x42}, 20))
+	assertEquals(t, err, errSignerClosed)
+}
+
+func Test_NewRemoteSigner_returnsAnErrorForAMalformedResponse(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		_, _, _ = readSignerFrame(server)
+		_ = writeSignerFrame(server, signerStatusOK, []byte{0x00, 0x00, 0x01})
+	}()
+
+	_, err := NewRemoteSigner(client)
+	assertEquals(t, err, errSignerProtocol)
+}
+
+func Test_RemoteSigner_returnsAnErrorIfTheSigningProcessDoesNotAnswer(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		_, _, _ = readSignerFrame(server)
+		_ = writeSignerFrame(server, signerStatusOK, alicePrivateKey.PublicKey().serialize())
+		_, _, _ = readSignerFrame(server)
+	}()
+	s, err := NewRemoteSigner(client)
+	assertNil(t, err)
+	s.SetTimeout(20 * time.Millisecond)
+
+	_, err = s.Sign(bytes.Repeat([]byte{0x42}, 20))
+	assertEquals(t, err, errSignerTimeout)
+	_, err = s.Sign(bytes.Repeat([]byte{0x42}, 20))
+	assertEquals(t, err, errSignerBroken)
+}
+
+func Test_RemoteSigner_cannotBeUsedAfterAMalformedFrame(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		_, _, _ = readSignerFrame(server)
+		_ = writeSignerFrame(server, signerStatusOK, alicePrivateKey.PublicKey().serialize())
+		_, _, _ = readSignerFrame(server)
+		_, _ = server.Write([]byte{0x7F, 0x00, 0x00, 0x00})
+		_ = ServeSigner(server, alicePrivateKey, rand.Reader)
+	}()
+	s, err := NewRemoteSigner(client)
+	assertNil(t, err)
+
+	_, err = s.Sign(bytes.Repeat([]byte{0x42}, 20))
+	assertEquals(t, err, errSignerProtocol)
+	_, err = s.Sign(bytes.Repeat([]byte{0x42}, 20))
+	assertEquals(t, err, errSignerBroken)
+}
+
+func Test_readSignerFrame_rejectsFramesThatAreTooLarge(t *testing.T) {
+	_, _, err := readSignerFrame(bytes.NewReader([]byte{0x7F, 0x00, 0x00, 0x00}))
+	assertEquals(t, err, errSignerProtocol)
+}
+
+func Test_SignerKey_cannotBeGeneratedOrSerialized(t *testing.T) {
+	s, _ := NewLoopbackSigner(alicePrivateKey, rand.Reader)
+	defer s.Close()
+	k := NewSignerKey(s)
+
+	assertEquals(t, k.Generate(rand.Reader), errSignerKeyHasNoPrivateMaterial)
+	assertNil(t, k.Serialize())
+	assertEquals(t, k.IsAvailableForVersion(3), true)
+	assertEquals(t, k.IsAvailableForVersion(4), false)
+}
+
+func Test_AKE_canBeCompletedWithKeysHeldByExternalSigners(t *testing.T) {
+	aliceSigner, _ := NewLoopbackSigner(alicePrivateKey, rand.Reader)
+	defer aliceSigner.Close()
+	bobSigner, _ := NewLoopbackSigner(bobPrivateKey, rand.Reader)
+	defer bobSigner.Close()
+
+	alice := &Conversation{Rand: rand.Reader}
+	alice.SetOurKeys([]PrivateKey{NewSignerKey(aliceSigner)})
+	alice.Policies = policies(allowV3)
+
+	bob := &Conversation{Rand: rand.Reader}
+	bob.SetOurKeys([]PrivateKey{NewSignerKey(bobSigner)})
+	bob.Policies = policies(allowV3)
+
+	completeAKE(t, alice, bob)
+
+	assertEquals(t, alice.IsEncrypted(), true)
+	assertEquals(t, bob.IsEncrypted(), true)
+	assertDeepEquals(t, alice.GetTheirKey().Fingerprint(), bobPrivateKey.PublicKey().Fingerprint())
+	assertDeepEquals(t, bob.GetTheirKey().Fingerprint(), alicePrivateKey.PublicKey().Fingerprint())
+}
+
+// completeAKE lets alice ask bob for an OTR conversation and passes the messages between them until the AKE is done
+func completeAKE(t *testing.T, alice, bob *Conversation) {
+	toSend := []ValidMessage{alice.QueryMessage()}
+	receivers := []*Conversation{bob, alice}
+	for i := 0; len(toSend) > 0; i++ {
+		var err error
+		_, toSend, err = receivers[i%2].Receive(toSend[0])
+		assertNil(t, err)
+	}
+}
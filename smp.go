@@ -1,7 +1,9 @@
 package otr3
 
 import (
+	"context"
 	"math/big"
+	"time"
 )
 
 type smp struct {
@@ -11,6 +13,12 @@ type smp struct {
 	s1       *smp1State
 	s2       *smp2State
 	s3       *smp3State
+
+	lastActivity time.Time
+	cancelSecret context.CancelFunc
+
+	job      *smpJob
+	jobError error
 }
 
 const smpVersion = 1
@@ -23,6 +31,8 @@ func (s *smp) wipe() {
 	s.s1 = nil
 	s.s2 = nil
 	s.s3 = nil
+	s.lastActivity = time.Time{}
+	s.cancelSecretRequest()
 }
 
 func (s *smp) ensureSMP() {
@@ -51,16 +61,19 @@ func generateSMPSecret(initiatorFingerprint, recipientFingerprint, ssid, secret
 	return new(big.Int).SetBytes(h.Sum(nil))
 }
 
+// generateDZKP calculates r - a*c mod q for the proofs, in constant time, since r and a are secret
 func generateDZKP(r, a, c *big.Int) *big.Int {
-	return subMod(r, mul(a, c), q)
+	return subMulModCT(r, a, c, q)
 }
 
 func generateZKP(r, a *big.Int, ix byte, v otrVersion) (c, d *big.Int) {
-	c = hashMPIsBN(v.hash2Instance(), ix, modExpP(g1, r))
+	c = hashMPIsBN(v.hash2Instance(), ix, modExpPSecret(g1, r))
 	d = generateDZKP(r, a, c)
 	return
 }
 
+// The exponents used when verifying the proofs from the peer are all public,
+// so the verifications use the faster variable time exponentiation
 func verifyZKP(d, gen, c *big.Int, ix byte, v otrVersion) bool {
 	r := modExpP(g1, d)
 	s := modExpP(gen, c)
@@ -0,0 +1,157 @@
+package otr3
+
+import "math/big"
+
+// SetAsynchronousSMP decides whether the SMP computations should run in the background. Every step of SMP
+// needs many modular exponentiations, which can take a noticeable time on slow devices. When this is turned on,
+// StartAuthenticate, ProvideAuthenticationSecret and Receive return right away without the SMP messages,
+// and the computation continues in a separate goroutine. Once it is done, the SMP messages to send will be
+// returned by the next call to Send, Receive or PendingAuthenticationMessages. AuthenticationStepDone can be used
+// to find out when that is. While the computation runs, the SMP event handler is called from its goroutine,
+// with finer grained SMPEventInProgress events, and the Rand of the conversation has to be safe for concurrent use.
+func (c *Conversation) SetAsynchronousSMP(v bool) {
+	c.asyncSMP = v
+}
+
+type smpJob struct {
+	done chan struct{}
+	flag byte
+	tlvs []tlv
+	err  error
+
+	// smp and verification are the results of the step, computed on copies so the conversation can be used meanwhile
+	smp          smp
+	verification *VerificationRecord
+}
+
+func (j *smpJob) isDone() bool {
+	select {
+	case <-j.done:
+		return true
+	default:
+		return false
+	}
+}
+
+var closedChannel = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// AuthenticationStepDone returns a channel that is closed when the SMP computation running in the background is done.
+// If nothing is running, the channel returned is already closed.
+func (c *Conversation) AuthenticationStepDone() <-chan struct{} {
+	if c.smp.job == nil {
+		return closedChannel
+	}
+	return c.smp.job.done
+}
+
+// PendingAuthenticationMessages returns the SMP messages computed in the background that are ready to be sent,
+// and the error from the computation, if it failed. It doesn't wait for a computation that is still running.
+func (c *Conversation) PendingAuthenticationMessages() ([]ValidMessage, error) {
+	c.collectSMPStep()
+	err := c.smp.jobError
+	c.smp.jobError = nil
+	return c.withInjects(nil), err
+}
+
+// runSMPStep runs one step of the SMP state machine, either right away, or in the background
+// if asynchronous SMP has been turned on. In that case, nothing is returned, and the result will be collected later.
+// In the background, the step works on a copy of the conversation, and only changes the SMP state and the verification
+// of the copy. They are moved to the conversation when the result is collected.
+func (c *Conversation) runSMPStep(flag byte, step func(*Conversation) ([]tlv, error)) ([]tlv, error) {
+	if !c.asyncSMP {
+		return step(c)
+	}
+
+	work := c.smpWorkingCopy()
+
+	job := &smpJob{done: make(chan struct{}), flag: flag}
+	c.smp.job = job
+	go func() {
+		defer close(job.done)
+		job.tlvs, job.err = step(work)
+		job.smp = work.smp
+		job.verification = work.verification
+	}()
+	return nil, nil
+}
+
+// smpWorkingCopy returns a conversation with copies of everything the SMP state machine uses
+func (c *Conversation) smpWorkingCopy() *Conversation {
+	return &Conversation{
+		version:                c.version,
+		Rand:                   c.Rand,
+		msgState:               c.msgState,
+		ssid:                   c.ssid,
+		ourCurrentKey:          c.ourCurrentKey,
+		theirKey:               c.theirKey,
+		smp:                    c.smp.copy(),
+		smpSecretNormalization: c.smpSecretNormalization,
+		asyncSMP:               c.asyncSMP,
+		smpEventHandler:        c.smpEventHandler,
+		smpSecretProvider:      c.smpSecretProvider,
+		trustStore:             c.trustStore,
+		verification:           c.verification,
+	}
+}
+
+// copy returns a copy of the SMP state that can be changed without changing this one
+func (s *smp) copy() smp {
+	res := *s
+	res.job = nil
+	res.jobError = nil
+	if s.secret != nil {
+		res.secret = new(big.Int).Set(s.secret)
+	}
+	return res
+}
+
+// waitForSMP waits for the computation running in the background, since the SMP state can't be used until it is done
+func (c *Conversation) waitForSMP() {
+	if c.smp.job == nil {
+		return
+	}
+	<-c.smp.job.done
+	c.collectSMPStep()
+}
+
+// collectSMPStep queues the messages from a finished background computation, to be sent with the next messages returned
+func (c *Conversation) collectSMPStep() {
+	job := c.smp.job
+	if job == nil || !job.isDone() {
+		return
+	}
+	jobError := c.smp.jobError
+	wipeBigInt(c.smp.secret)
+	c.smp = job.smp
+	c.smp.jobError = jobError
+	c.verification = job.verification
+
+	if job.err != nil {
+		c.smp.jobError = job.err
+		return
+	}
+	if len(job.tlvs) == 0 || !c.IsEncrypted() {
+		return
+	}
+
+	msgs, _, err := c.createSerializedDataMessage(nil, job.flag, job.tlvs)
+	if err != nil {
+		c.smp.jobError = err
+		return
+	}
+	for _, m := range msgs {
+		c.injectMessage(m)
+	}
+}
+
+// smpProgress notifies the UI about progress in the middle of an SMP step. This is only useful when
+// the computation is running in the background, since the UI can't update in the middle of a call otherwise.
+func (c *Conversation) smpProgress(percent int) {
+	if c.asyncSMP {
+		c.smpEvent(SMPEventInProgress, percent)
+	}
+}
@@ -0,0 +1,165 @@
+package otr3
+
+import (
+	"sync"
+	"testing"
+)
+
+type recordedSMPEvents struct {
+	sync.Mutex
+	events   []SMPEvent
+	percents []int
+}
+
+func (r *recordedSMPEvents) HandleSMPEvent(event SMPEvent, progressPercent int, question string) {
+	r.Lock()
+	defer r.Unlock()
+	r.events = append(r.events, event)
+	r.percents = append(r.percents, progressPercent)
+}
+
+func waitForPendingAuthenticationMessages(t *testing.T, c *Conversation) []ValidMessage {
+	<-c.AuthenticationStepDone()
+	msgs, err := c.PendingAuthenticationMessages()
+	assertNil(t, err)
+	return msgs
+}
+
+func deliverAllAsync(t *testing.T, to *Conversation, msgs []ValidMessage) []ValidMessage {
+	toSend := deliverAll(t, to, msgs)
+	return append(toSend, waitForPendingAuthenticationMessages(t, to)...)
+}
+
+func Test_AsynchronousSMP_returnsTheMessagesLater(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	alice.SetAsynchronousSMP(true)
+	bob.SetAsynchronousSMP(true)
+
+	toSend, err := alice.StartAuthenticate("", []byte("secret"))
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 0)
+	toSend = waitForPendingAuthenticationMessages(t, alice)
+	assertEquals(t, len(toSend), 1)
+	assertEquals(t, alice.smp.state, smpStateExpect2{})
+
+	assertEquals(t, len(deliverAllAsync(t, bob, toSend)), 0)
+
+	toSend, err = bob.ProvideAuthenticationSecret([]byte("secret"))
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 0)
+	toSend = waitForPendingAuthenticationMessages(t, bob)
+	assertEquals(t, len(toSend), 1)
+
+	toSend = deliverAllAsync(t, alice, toSend)
+	assertEquals(t, len(toSend), 1)
+	toSend = deliverAllAsync(t, bob, toSend)
+	assertEquals(t, len(toSend), 1)
+	deliverAllAsync(t, alice, toSend)
+
+	assertEquals(t, alice.IsVerified(), true)
+	assertEquals(t, bob.IsVerified(), true)
+}
+
+func Test_AsynchronousSMP_reportsFinerProgress(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	alice.SetAsynchronousSMP(true)
+	bob.SetAsynchronousSMP(true)
+	aliceEvents := &recordedSMPEvents{}
+	bobEvents := &recordedSMPEvents{}
+	alice.SetSMPEventHandler(aliceEvents)
+	bob.SetSMPEventHandler(bobEvents)
+
+	alice.StartAuthenticate("", []byte("secret"))
+	toSend := waitForPendingAuthenticationMessages(t, alice)
+	deliverAllAsync(t, bob, toSend)
+	bob.ProvideAuthenticationSecret([]byte("secret"))
+	toSend = waitForPendingAuthenticationMessages(t, bob)
+	toSend = deliverAllAsync(t, alice, toSend)
+	toSend = deliverAllAsync(t, bob, toSend)
+	deliverAllAsync(t, alice, toSend)
+
+	assertDeepEquals(t, aliceEvents.events, []SMPEvent{SMPEventInProgress, SMPEventInProgress, SMPEventInProgress, SMPEventInProgress, SMPEventSuccess})
+	assertDeepEquals(t, aliceEvents.percents, []int{20, 40, 60, 80, 100})
+	assertDeepEquals(t, bobEvents.events, []SMPEvent{SMPEventAskForSecret, SMPEventInProgress, SMPEventInProgress, SMPEventSuccess})
+	assertDeepEquals(t, bobEvents.percents, []int{25, 50, 75, 100})
+}
+
+func Test_SynchronousSMP_doesNotReportTheFinerProgress(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	aliceEvents := &recordedSMPEvents{}
+	alice.SetSMPEventHandler(aliceEvents)
+
+	completeSMP(t, alice, bob, "", []byte("secret"), []byte("secret"))
+
+	assertDeepEquals(t, aliceEvents.percents, []int{60, 100})
+}
+
+func Test_AsynchronousSMP_messagesAreAlsoReturnedFromTheNextSend(t *testing.T) {
+	alice, _ := conversationsAfterAKE(t)
+	alice.SetAsynchronousSMP(true)
+
+	alice.StartAuthenticate("", []byte("secret"))
+	<-alice.AuthenticationStepDone()
+
+	toSend, err := alice.Send(ValidMessage("hello"))
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 2)
+}
+
+func Test_AsynchronousSMP_reportsErrorsFromTheComputation(t *testing.T) {
+	alice, _ := conversationsAfterAKE(t)
+	alice.SetAsynchronousSMP(true)
+
+	_, err := alice.ProvideAuthenticationSecret([]byte("secret"))
+	assertNil(t, err)
+
+	<-alice.AuthenticationStepDone()
+	msgs, err := alice.PendingAuthenticationMessages()
+	assertNil(t, msgs)
+	assertEquals(t, err, errNotWaitingForSMPSecret)
+}
+
+func Test_AsynchronousSMP_abortWaitsForTheRunningComputation(t *testing.T) {
+	alice, _ := conversationsAfterAKE(t)
+	alice.SetAsynchronousSMP(true)
+
+	alice.StartAuthenticate("", []byte("secret"))
+	toSend, err := alice.AbortAuthentication()
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 1)
+	assertEquals(t, alice.smp.state, smpStateExpect1{})
+
+	msgs, err := alice.PendingAuthenticationMessages()
+	assertNil(t, err)
+	assertEquals(t, len(msgs), 1)
+}
+
+func Test_AsynchronousSMP_theConversationCanBeUsedWhileAStepRuns(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	alice.SetAsynchronousSMP(true)
+
+	alice.StartAuthenticate("", []byte("secret"))
+	assertEquals(t, alice.IsVerified(), false)
+
+	alice.AbortAuthentication()
+	alice.StartAuthenticate("", []byte("secret"))
+
+	toSend := []ValidMessage{bob.QueryMessage()}
+	receivers := []*Conversation{alice, bob}
+	for i := 0; len(toSend) > 0; i++ {
+		toSend = deliverAll(t, receivers[i%2], toSend)
+	}
+
+	assertEquals(t, alice.IsEncrypted(), true)
+	assertEquals(t, alice.IsVerified(), false)
+	assertEquals(t, alice.smp.state, smpStateExpect2{})
+}
+
+func Test_AuthenticationStepDone_isClosedWhenNothingIsRunning(t *testing.T) {
+	c := &Conversation{}
+	select {
+	case <-c.AuthenticationStepDone():
+	default:
+		t.Errorf("expected the channel to be closed")
+	}
+}
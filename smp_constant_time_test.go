@@ -0,0 +1,222 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"math/big"
+	"os"
+	"sort"
+	"testing"
+	"time"
+)
+
+func Test_modExpPSecret_calculatesTheSameAsModExpP(t *testing.T) {
+	values := []*big.Int{
+		big.NewInt(0),
+		big.NewInt(1),
+		big.NewInt(2),
+		new(big.Int).Sub(q, big.NewInt(1)),
+		new(big.Int).Sub(p, big.NewInt(1)),
+		bnFromHex("3D7264BD983B8CA53CB365444844816F7D2453580B552EEE45CD09CA13614A5"),
+	}
+	bases := []*big.Int{g1, big.NewInt(3), new(big.Int).Sub(p, big.NewInt(2))}
+
+	for _, b := range bases {
+		for _, x := range values {
+			assertDeepEquals(t, modExpPSecret(b, x), modExpP(b, x))
+		}
+	}
+}
+
+func Test_modExpPSecret_acceptsExponentsLargerThanP(t *testing.T) {
+	x := new(big.Int).Lsh(p, 3)
+	assertDeepEquals(t, modExpPSecret(g1, x), modExpP(g1, x))
+}
+
+func Test_generateDZKP_calculatesTheSameAsMathBig(t *testing.T) {
+	values := []*big.Int{
+		big.NewInt(0),
+		big.NewInt(1),
+		new(big.Int).Sub(q, big.NewInt(1)),
+		q,
+		new(big.Int).Sub(p, big.NewInt(1)),
+		bnFromHex("3D7264BD983B8CA53CB365444844816F7D2453580B552EEE45CD09CA13614A5"),
+		randomSMPExponent(t),
+		randomSMPExponent(t),
+	}
+
+	for _, r := range values {
+		for _, a := range values {
+			for _, c := range values {
+				assertEquals(t, generateDZKP(r, a, c).Text(16), variableTimeDZKP(r, a, c).Text(16))
+			}
+		}
+	}
+}
+
+func Test_generateDZKP_acceptsValuesLargerThanP(t *testing.T) {
+	r := new(big.Int).Lsh(p, 70)
+	a := new(big.Int).Add(new(big.Int).Lsh(q, 65), big.NewInt(7))
+	c := new(big.Int).Lsh(p, 3)
+	assertEquals(t, generateDZKP(r, a, c).Text(16), variableTimeDZKP(r, a, c).Text(16))
+}
+
+func Test_reduceLimbs_calculatesTheRemainder(t *testing.T) {
+	m := limbsFromBig(q, secretLimbs)
+	x := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 64*2*secretLimbs), big.NewInt(1))
+	assertEquals(t, reduceLimbs(limbsFromBig(x, 2*secretLimbs), m).big().Text(16), mod(x, q).Text(16))
+}
+
+func randomSMPExponent(tb testing.TB) *big.Int {
+	x, err := rand.Int(rand.Reader, q)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return x
+}
+
+func BenchmarkModExpP(b *testing.B) {
+	x := randomSMPExponent(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		modExpP(g1, x)
+	}
+}
+
+func BenchmarkModExpPSecret(b *testing.B) {
+	x := randomSMPExponent(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		modExpPSecret(g1, x)
+	}
+}
+
+func BenchmarkGenerateDZKP(b *testing.B) {
+	r := randomSMPExponent(b)
+	a := randomSMPExponent(b)
+	c := randomSMPExponent(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		generateDZKP(r, a, c)
+	}
+}
+
+func deliverAllIgnoringErrors(to *Conversation, msgs []ValidMessage) []ValidMessage {
+	var toSend []ValidMessage
+	for _, m := range msgs {
+		_, res, _ := to.Receive(m)
+		toSend = append(toSend, res...)
+	}
+	return toSend
+}
+
+func BenchmarkSMP(b *testing.B) {
+	alice := &Conversation{Rand: rand.Reader}
+	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
+	alice.Policies = policies(allowV3)
+	bob := &Conversation{Rand: rand.Reader}
+	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
+	bob.Policies = policies(allowV3)
+
+	toSend := []ValidMessage{alice.QueryMessage()}
+	for i := 0; len(toSend) > 0; i++ {
+		toSend = deliverAllIgnoringErrors([]*Conversation{bob, alice}[i%2], toSend)
+	}
+	if !alice.IsEncrypted() || !bob.IsEncrypted() {
+		b.Fatal("the AKE didn't finish")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		toSend, _ := alice.StartAuthenticate("", []byte("secret"))
+		deliverAllIgnoringErrors(bob, toSend)
+		toSend, _ = bob.ProvideAuthenticationSecret([]byte("secret"))
+		toSend = deliverAllIgnoringErrors(alice, toSend)
+		toSend = deliverAllIgnoringErrors(bob, toSend)
+		deliverAllIgnoringErrors(alice, toSend)
+	}
+}
+
+// medianDuration runs f the given number of times, and returns the median time it took
+func medianDuration(rounds int, f func()) time.Duration {
+	ds := make([]time.Duration, rounds)
+	for i := range ds {
+		start := time.Now()
+		f()
+		ds[i] = time.Since(start)
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	return ds[rounds/2]
+}
+
+// timingVariance compares how long the exponentiation takes for an exponent with few bits set
+// and for one with almost all bits set, and returns the relative difference between the two
+func timingVariance(rounds int, exp func(g, x *big.Int) *big.Int) float64 {
+	low := big.NewInt(1)
+	high := new(big.Int).Sub(q, big.NewInt(1))
+
+	dl := medianDuration(rounds, func() { exp(g1, low) })
+	dh := medianDuration(rounds, func() { exp(g1, high) })
+
+	if dl > dh {
+		dl, dh = dh, dl
+	}
+	return float64(dh-dl) / float64(dh)
+}
+
+// Test_modExpPSecret_takesTheSameTimeForAllExponents measures the timing variance of the exponentiations.
+// Timing measurements are too noisy for normal test runs, so it only runs when OTR3_TIMING_TESTS is set.
+func Test_modExpPSecret_takesTheSameTimeForAllExponents(t *testing.T) {
+	if os.Getenv("OTR3_TIMING_TESTS") == "" {
+		t.Skip("set OTR3_TIMING_TESTS to run the timing variance tests")
+	}
+
+	variable := timingVariance(51, modExpP)
+	constant := timingVariance(51, modExpPSecret)
+	t.Logf("relative timing difference: variable time %.3f, constant time %.3f", variable, constant)
+
+	if constant > 0.1 {
+		t.Errorf("expected the constant time exponentiation to take the same time for all exponents, but the difference was %.3f", constant)
+	}
+	if variable < constant {
+		t.Errorf("expected the variable time exponentiation to vary more than the constant time one")
+	}
+}
+
+// dzkpTimingVariance compares how long calculating a proof takes for small secret values and for
+// ones with almost all bits set, and returns the relative difference between the two
+func dzkpTimingVariance(rounds int, dzkp func(r, a, c *big.Int) *big.Int) float64 {
+	c := bnFromHex("3D7264BD983B8CA53CB365444844816F7D2453580B552EEE45CD09CA13614A5")
+	low := big.NewInt(1)
+	high := new(big.Int).Sub(q, big.NewInt(1))
+
+	dl := medianDuration(rounds, func() { dzkp(low, low, c) })
+	dh := medianDuration(rounds, func() { dzkp(low, high, c) })
+
+	if dl > dh {
+		dl, dh = dh, dl
+	}
+	return float64(dh-dl) / float64(dh)
+}
+
+func variableTimeDZKP(r, a, c *big.Int) *big.Int {
+	return subMod(r, mul(a, c), q)
+}
+
+// Test_generateDZKP_takesTheSameTimeForAllSecrets measures the timing variance of the proofs.
+// Like the exponentiation test, it only runs when OTR3_TIMING_TESTS is set.
+func Test_generateDZKP_takesTheSameTimeForAllSecrets(t *testing.T) {
+	if os.Getenv("OTR3_TIMING_TESTS") == "" {
+		t.Skip("set OTR3_TIMING_TESTS to run the timing variance tests")
+	}
+
+	variable := dzkpTimingVariance(501, variableTimeDZKP)
+	constant := dzkpTimingVariance(501, generateDZKP)
+	t.Logf("relative timing difference: variable time %.3f, constant time %.3f", variable, constant)
+
+	if constant > 0.1 {
+		t.Errorf("expected the constant time proofs to take the same time for all secrets, but the difference was %.3f", constant)
+	}
+	if variable < constant {
+		t.Errorf("expected the variable time proofs to vary more than the constant time ones")
+	}
+}
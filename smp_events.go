@@ -22,6 +22,8 @@ const (
 	SMPEventSuccess
 	// SMPEventFailure means update the auth progress dialog with progress_percent
 	SMPEventFailure
+	// SMPEventTimeout means the peer didn't answer within the SMP timeout, so the current auth was aborted. Close the auth progress dialog
+	SMPEventTimeout
 )
 
 // SMPEventHandler handles SMPEvents
@@ -68,6 +70,8 @@ func (s SMPEvent) String() string {
 		return "SMPEventSuccess"
 	case SMPEventFailure:
 		return "SMPEventFailure"
+	case SMPEventTimeout:
+		return "SMPEventTimeout"
 	default:
 		return "SMP EVENT: (THIS SHOULD NEVER HAPPEN)"
 	}
@@ -0,0 +1,79 @@
+package otr3
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// SMPSecretNormalization decides how the secret typed by the user is normalized before it is used for SMP,
+// so that small differences in how the answer was typed don't make the authentication fail.
+// Both peers have to use the same normalization for the authentication to succeed. The default is to not
+// normalize the secret at all, which is what libotr does.
+type SMPSecretNormalization int
+
+const (
+	// NormalizeNFKC converts the secret to Unicode normalization form NFKC, so that different ways of writing the same characters match
+	NormalizeNFKC SMPSecretNormalization = 1 << iota
+	// NormalizeCaseFold folds the case of the secret, so that "Paris" and "paris" match
+	NormalizeCaseFold
+	// NormalizeTrimSpace removes leading and trailing whitespace from the secret, so that "paris " and "paris" match
+	NormalizeTrimSpace
+)
+
+// NormalizeAll uses all the available normalizations
+const NormalizeAll = NormalizeNFKC | NormalizeCaseFold | NormalizeTrimSpace
+
+// SetSMPSecretNormalization sets the normalization used for all secrets given to StartAuthenticate and ProvideAuthenticationSecret
+func (c *Conversation) SetSMPSecretNormalization(n SMPSecretNormalization) {
+	c.smpSecretNormalization = n
+}
+
+// SMPSecretNormalization returns the normalization used for secrets, so that the UI can tell the user how the answer will be compared
+func (c *Conversation) SMPSecretNormalization() SMPSecretNormalization {
+	return c.smpSecretNormalization
+}
+
+// Normalize returns the secret normalized. Without any normalization, the secret is returned unchanged.
+func (n SMPSecretNormalization) Normalize(secret []byte) []byte {
+	if n&NormalizeTrimSpace != 0 {
+		secret = bytes.TrimSpace(secret)
+	}
+	if n&NormalizeNFKC != 0 {
+		secret = norm.NFKC.Bytes(secret)
+	}
+	if n&NormalizeCaseFold != 0 {
+		secret = cases.Fold().Bytes(secret)
+		if n&NormalizeNFKC != 0 {
+			// Case folding can produce characters that are not in NFKC anymore
+			secret = norm.NFKC.Bytes(secret)
+		}
+	}
+	return secret
+}
+
+// Description returns a short description of how secrets are compared, meant to be shown next to the question in the UI,
+// such as "ignoring case and surrounding whitespace". It is empty when no normalization is used.
+func (n SMPSecretNormalization) Description() string {
+	var parts []string
+	if n&NormalizeNFKC != 0 {
+		parts = append(parts, "Unicode compatibility differences")
+	}
+	if n&NormalizeCaseFold != 0 {
+		parts = append(parts, "case")
+	}
+	if n&NormalizeTrimSpace != 0 {
+		parts = append(parts, "surrounding whitespace")
+	}
+
+	switch len(parts) {
+	case 0:
+		return ""
+	case 1:
+		return "ignoring " + parts[0]
+	default:
+		return "ignoring " + strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+	}
+}
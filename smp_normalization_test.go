@@ -0,0 +1,68 @@
+package otr3
+
+import "testing"
+
+func Test_SMPSecretNormalization_leavesTheSecretUnchangedByDefault(t *testing.T) {
+	var n SMPSecretNormalization
+	assertDeepEquals(t, n.Normalize([]byte(" Paris\n")), []byte(" Paris\n"))
+	assertEquals(t, n.Description(), "")
+}
+
+func Test_SMPSecretNormalization_trimsWhitespace(t *testing.T) {
+	assertDeepEquals(t, NormalizeTrimSpace.Normalize([]byte(" \tParis  \n")), []byte("Paris"))
+}
+
+func Test_SMPSecretNormalization_foldsCase(t *testing.T) {
+	assertDeepEquals(t, NormalizeCaseFold.Normalize([]byte("PaRiS Straße")), []byte("paris strasse"))
+}
+
+func Test_SMPSecretNormalization_convertsToNFKC(t *testing.T) {
+	// e followed by a combining acute accent, and a fullwidth A
+	assertDeepEquals(t, NormalizeNFKC.Normalize([]byte("café Ａ")), []byte("café A"))
+}
+
+func Test_SMPSecretNormalization_combinesAllNormalizations(t *testing.T) {
+	one := NormalizeAll.Normalize([]byte("  CAFÉ\n"))
+	two := NormalizeAll.Normalize([]byte("café"))
+	assertDeepEquals(t, one, two)
+}
+
+func Test_SMPSecretNormalization_describesTheNormalizations(t *testing.T) {
+	assertEquals(t, NormalizeCaseFold.Description(), "ignoring case")
+	assertEquals(t, (NormalizeCaseFold | NormalizeTrimSpace).Description(), "ignoring case and surrounding whitespace")
+	assertEquals(t, NormalizeAll.Description(), "ignoring Unicode compatibility differences, case and surrounding whitespace")
+}
+
+func Test_SMPSecretNormalization_letsAuthenticationSucceedWithDifferentlyTypedAnswers(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	alice.SetSMPSecretNormalization(NormalizeAll)
+	bob.SetSMPSecretNormalization(NormalizeAll)
+	assertEquals(t, bob.SMPSecretNormalization(), NormalizeAll)
+
+	completeSMP(t, alice, bob, "capital?", []byte("Paris"), []byte("paris "))
+
+	assertEquals(t, alice.IsVerified(), true)
+	assertEquals(t, bob.IsVerified(), true)
+}
+
+func Test_SMPSecretNormalization_isNotUsedByDefault(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+
+	completeSMP(t, alice, bob, "capital?", []byte("Paris"), []byte("paris "))
+
+	assertEquals(t, alice.IsVerified(), false)
+	assertEquals(t, bob.IsVerified(), false)
+}
+
+func Test_SMPSecretNormalization_generatesTheSameSecretAsLibotrForNormalizedInput(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.ssid = [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+	c.ourCurrentKey = alicePrivateKey
+	c.theirKey = bobPrivateKey.PublicKey()
+	c.SetSMPSecretNormalization(NormalizeAll)
+
+	_, e := c.StartAuthenticate("", []byte(" hello world\n"))
+	assertNil(t, e)
+	assertDeepEquals(t, c.smp.secret, bnFromHex("3D7264BD983B8CA53CB365444844816F7D2453580B552EEE45CD09CA13614A5"))
+}
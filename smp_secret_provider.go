@@ -0,0 +1,69 @@
+package otr3
+
+import "context"
+
+// SMPSecretProvider supplies the secret when the peer starts an authentication, for example from a password manager,
+// a shared secret vault or the configuration of a bot.
+//
+// SMPSecret is called with the question the peer asked, or an empty string if there was no question.
+// If the secret is known right away, it should be returned together with true, and the answer to the peer will be
+// part of the messages returned from Receive. Otherwise it should return false. The UI is then notified as usual,
+// and the provider can look up the secret in the background and give it to ProvideAuthenticationSecret
+// once it is found, from the same goroutine the conversation is used from. The context is cancelled as soon as
+// the secret isn't needed anymore, because it was provided, the authentication was aborted or the conversation ended.
+type SMPSecretProvider interface {
+	SMPSecret(ctx context.Context, question string) ([]byte, bool)
+}
+
+// SetSMPSecretProvider sets the provider that will be asked for the secret when the peer starts an authentication
+func (c *Conversation) SetSMPSecretProvider(p SMPSecretProvider) {
+	c.smpSecretProvider = p
+}
+
+type dynamicSMPSecretProvider struct {
+	f func(ctx context.Context, question string) ([]byte, bool)
+}
+
+func (d dynamicSMPSecretProvider) SMPSecret(ctx context.Context, question string) ([]byte, bool) {
+	return d.f(ctx, question)
+}
+
+// StaticSMPSecrets is an SMPSecretProvider that answers from a fixed set of answers, keyed by question.
+// The answer for authentications without a question is found under the empty string.
+// It is meant for bots that answer authentications automatically, based on their configuration.
+type StaticSMPSecrets map[string]string
+
+// SMPSecret returns the configured answer for the question, if there is one
+func (s StaticSMPSecrets) SMPSecret(_ context.Context, question string) ([]byte, bool) {
+	answer, ok := s[question]
+	if !ok {
+		return nil, false
+	}
+	return []byte(answer), true
+}
+
+func (c *Conversation) askSMPSecretProvider(question string) ([]byte, bool) {
+	if c.smpSecretProvider == nil {
+		return nil, false
+	}
+
+	c.smp.cancelSecretRequest()
+	ctx, cancel := context.WithCancel(context.Background())
+	c.smp.cancelSecret = cancel
+	return c.smpSecretProvider.SMPSecret(ctx, question)
+}
+
+func (s *smp) cancelSecretRequest() {
+	if s.cancelSecret != nil {
+		s.cancelSecret()
+		s.cancelSecret = nil
+	}
+}
+
+// smpStateChanged should be called every time the SMP state machine has been moved
+func (c *Conversation) smpStateChanged() {
+	c.smp.touch()
+	if _, waiting := c.smp.state.(smpStateWaitingForSecret); !waiting {
+		c.smp.cancelSecretRequest()
+	}
+}
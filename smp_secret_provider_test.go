@@ -0,0 +1,145 @@
+package otr3
+
+import (
+	"context"
+	"testing"
+)
+
+func Test_SMPSecretProvider_answersAutomaticallyWhenTheSecretIsKnown(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	bob.SetSMPSecretProvider(StaticSMPSecrets{"favourite color?": "blue"})
+	var bobEvents []SMPEvent
+	bob.smpEventHandler = dynamicSMPEventHandler{func(e SMPEvent, _ int, _ string) {
+		bobEvents = append(bobEvents, e)
+	}}
+	var aliceEvents []SMPEvent
+	alice.smpEventHandler = dynamicSMPEventHandler{func(e SMPEvent, _ int, _ string) {
+		aliceEvents = append(aliceEvents, e)
+	}}
+
+	toSend, err := alice.StartAuthenticate("favourite color?", []byte("blue"))
+	assertNil(t, err)
+	toSend = deliverAll(t, bob, toSend)
+	assertEquals(t, len(toSend), 1)
+	assertEquals(t, bob.smp.state, smpStateExpect3{})
+
+	toSend = deliverAll(t, alice, toSend)
+	toSend = deliverAll(t, bob, toSend)
+	deliverAll(t, alice, toSend)
+
+	assertDeepEquals(t, bobEvents, []SMPEvent{SMPEventSuccess})
+	assertDeepEquals(t, aliceEvents, []SMPEvent{SMPEventInProgress, SMPEventSuccess})
+	assertEquals(t, alice.IsVerified(), true)
+}
+
+func Test_SMPSecretProvider_fallsBackToTheUIWhenTheSecretIsNotKnown(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	bob.SetSMPSecretProvider(StaticSMPSecrets{"": "blue"})
+	var question string
+	var events []SMPEvent
+	bob.smpEventHandler = dynamicSMPEventHandler{func(e SMPEvent, _ int, q string) {
+		events = append(events, e)
+		question = q
+	}}
+
+	toSend, err := alice.StartAuthenticate("favourite color?", []byte("blue"))
+	assertNil(t, err)
+	assertEquals(t, len(deliverAll(t, bob, toSend)), 0)
+
+	assertDeepEquals(t, events, []SMPEvent{SMPEventAskForAnswer})
+	assertEquals(t, question, "favourite color?")
+	assertEquals(t, bob.smp.state.identity(), smpStateWaitingForSecret{}.identity())
+}
+
+func Test_SMPSecretProvider_isGivenTheQuestion(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	var asked []string
+	bob.SetSMPSecretProvider(dynamicSMPSecretProvider{func(_ context.Context, q string) ([]byte, bool) {
+		asked = append(asked, q)
+		return nil, false
+	}})
+
+	toSend, _ := alice.StartAuthenticate("", []byte("blue"))
+	deliverAll(t, bob, toSend)
+	toSend, _ = alice.StartAuthenticate("what?", []byte("blue"))
+	deliverAll(t, bob, toSend)
+
+	assertDeepEquals(t, asked, []string{"", "what?"})
+}
+
+func Test_SMPSecretProvider_canAnswerLaterAndTheRequestIsThenCancelled(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	var ctx context.Context
+	bob.SetSMPSecretProvider(dynamicSMPSecretProvider{func(c context.Context, _ string) ([]byte, bool) {
+		ctx = c
+		return nil, false
+	}})
+
+	toSend, _ := alice.StartAuthenticate("", []byte("blue"))
+	deliverAll(t, bob, toSend)
+	assertNil(t, ctx.Err())
+
+	toSend, err := bob.ProvideAuthenticationSecret([]byte("blue"))
+	assertNil(t, err)
+	assertEquals(t, ctx.Err(), context.Canceled)
+
+	toSend = deliverAll(t, alice, toSend)
+	toSend = deliverAll(t, bob, toSend)
+	deliverAll(t, alice, toSend)
+	assertEquals(t, alice.IsVerified(), true)
+	assertEquals(t, bob.IsVerified(), true)
+}
+
+func Test_SMPSecretProvider_requestIsCancelledWhenThePeerAborts(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	var ctx context.Context
+	bob.SetSMPSecretProvider(dynamicSMPSecretProvider{func(c context.Context, _ string) ([]byte, bool) {
+		ctx = c
+		return nil, false
+	}})
+
+	toSend, _ := alice.StartAuthenticate("", []byte("blue"))
+	deliverAll(t, bob, toSend)
+
+	toSend, err := alice.AbortAuthentication()
+	assertNil(t, err)
+	deliverAll(t, bob, toSend)
+
+	assertEquals(t, ctx.Err(), context.Canceled)
+}
+
+func Test_SMPSecretProvider_requestIsCancelledWhenWeAbortOrTheConversationEnds(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	var ctxs []context.Context
+	bob.SetSMPSecretProvider(dynamicSMPSecretProvider{func(c context.Context, _ string) ([]byte, bool) {
+		ctxs = append(ctxs, c)
+		return nil, false
+	}})
+
+	toSend, _ := alice.StartAuthenticate("", []byte("blue"))
+	deliverAll(t, bob, toSend)
+	_, err := bob.AbortAuthentication()
+	assertNil(t, err)
+	assertEquals(t, ctxs[0].Err(), context.Canceled)
+
+	toSend, _ = alice.StartAuthenticate("", []byte("blue"))
+	deliverAll(t, bob, toSend)
+	_, err = bob.End()
+	assertNil(t, err)
+	assertEquals(t, ctxs[1].Err(), context.Canceled)
+}
+
+func Test_StaticSMPSecrets_answersFromTheConfiguredSecrets(t *testing.T) {
+	s := StaticSMPSecrets{"": "one", "q": "two"}
+
+	res, ok := s.SMPSecret(context.Background(), "")
+	assertEquals(t, ok, true)
+	assertDeepEquals(t, res, []byte("one"))
+
+	res, ok = s.SMPSecret(context.Background(), "q")
+	assertEquals(t, ok, true)
+	assertDeepEquals(t, res, []byte("two"))
+
+	_, ok = s.SMPSecret(context.Background(), "other")
+	assertEquals(t, ok, false)
+}
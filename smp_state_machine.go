@@ -29,6 +29,7 @@ type smpState interface {
 func (c *Conversation) restartSMP() tlv {
 	var ret smpMessage
 	c.smp.state, ret, _ = sendSMPAbortAndRestartStateMachine()
+	c.smpStateChanged()
 	return ret.tlv()
 }
 
@@ -48,6 +49,7 @@ func (c *Conversation) abortStateMachineAndNotifyCheated() (smpState, smpMessage
 
 func (c *Conversation) receiveSMP(m smpMessage) (*tlv, error) {
 	toSend, err := m.receivedMessage(c)
+	c.smpStateChanged()
 
 	if err != nil {
 		return nil, err
@@ -64,6 +66,7 @@ func (c *Conversation) receiveSMP(m smpMessage) (*tlv, error) {
 
 func (c *Conversation) continueSMP(mutualSecret []byte) (*tlv, error) {
 	toSend, err := c.continueMessage(mutualSecret)
+	c.smpStateChanged()
 
 	if err != nil {
 		return nil, err
@@ -107,6 +110,13 @@ func (smpStateExpect1) receiveMessage1(c *Conversation, m smp1Message) (smpState
 
 	if m.hasQuestion {
 		c.smp.question = &m.question
+	}
+
+	if secret, ok := c.askSMPSecretProvider(m.question); ok {
+		return smpStateWaitingForSecret{msg: m}.continueMessage1(c, secret)
+	}
+
+	if m.hasQuestion {
 		c.smpEventWithQuestion(SMPEventAskForAnswer, 25, m.question)
 	} else {
 		c.smpEvent(SMPEventAskForSecret, 25)
@@ -121,11 +131,12 @@ func (s smpStateWaitingForSecret) continueMessage1(c *Conversation, mutualSecret
 	}
 
 	// Using ssid here should always be safe - we can't be in an encrypted state without having gone through the AKE
-	c.smp.secret = generateSMPSecret(c.theirKey.Fingerprint(), c.ourCurrentKey.PublicKey().Fingerprint(), c.ssid[:], mutualSecret, c.version)
+	c.smp.secret = generateSMPSecret(c.theirKey.Fingerprint(), c.ourCurrentKey.PublicKey().Fingerprint(), c.ssid[:], c.smpSecretNormalization.Normalize(mutualSecret), c.version)
 	s2, err := c.generateSMP2(c.smp.secret, s.msg)
 	if err != nil {
 		return c.abortStateMachineAndNotifyCheated()
 	}
+	c.smpProgress(50)
 
 	c.smp.s2 = &s2
 
@@ -137,6 +148,7 @@ func (smpStateExpect2) receiveMessage2(c *Conversation, m smp2Message) (smpState
 	if err != nil {
 		return c.abortStateMachineAndNotifyCheated()
 	}
+	c.smpProgress(40)
 
 	s3, err := c.generateSMP3(c.smp.secret, *c.smp.s1, m)
 	if err != nil {
@@ -155,12 +167,14 @@ func (smpStateExpect3) receiveMessage3(c *Conversation, m smp3Message) (smpState
 	if err != nil {
 		return c.abortStateMachineAndNotifyCheated()
 	}
+	c.smpProgress(75)
 
 	err = c.verifySMP3ProtocolSuccess(c.smp.s2, m)
 	if err != nil {
 		c.smpEvent(SMPEventFailure, 100)
 		return sendSMPAbortAndRestartStateMachine()
 	}
+	c.smpVerified(false)
 	c.smpEvent(SMPEventSuccess, 100)
 
 	ret, err := c.generateSMP4(c.smp.secret, *c.smp.s2, m)
@@ -177,12 +191,14 @@ func (smpStateExpect4) receiveMessage4(c *Conversation, m smp4Message) (smpState
 	if err != nil {
 		return c.abortStateMachineAndNotifyCheated()
 	}
+	c.smpProgress(80)
 
 	err = c.verifySMP4ProtocolSuccess(c.smp.s1, c.smp.s3, m)
 	if err != nil {
 		c.smpEvent(SMPEventFailure, 100)
 		return sendSMPAbortAndRestartStateMachine()
 	}
+	c.smpVerified(true)
 	c.smpEvent(SMPEventSuccess, 100)
 
 	c.smp.wipe()
@@ -238,7 +254,7 @@ func (smpStateExpect1) startAuthenticate(c *Conversation, question string, mutua
 	}
 
 	// Using ssid here should always be safe - we can't be in an encrypted state without having gone through the AKE
-	c.smp.secret = generateSMPSecret(c.ourCurrentKey.PublicKey().Fingerprint(), c.theirKey.Fingerprint(), c.ssid[:], mutualSecret, c.version)
+	c.smp.secret = generateSMPSecret(c.ourCurrentKey.PublicKey().Fingerprint(), c.theirKey.Fingerprint(), c.ssid[:], c.smpSecretNormalization.Normalize(mutualSecret), c.version)
 
 	s1, err := c.generateSMP1()
 	if err != nil {
@@ -252,6 +268,7 @@ func (smpStateExpect1) startAuthenticate(c *Conversation, question string, mutua
 
 	c.smp.s1 = &s1
 	c.smp.state = smpStateExpect2{}
+	c.smpProgress(20)
 
 	return []tlv{s1.msg.tlv()}, nil
 }
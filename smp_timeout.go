@@ -0,0 +1,51 @@
+package otr3
+
+import "time"
+
+// SetSMPTimeout sets how long to wait for the peer to answer during an authentication.
+// If no SMP message has been sent or received for longer than this, the next call to CheckSMPTimeout
+// will abort the authentication. A timeout of zero, which is the default, disables this.
+func (c *Conversation) SetSMPTimeout(d time.Duration) {
+	c.smpTimeout = d
+}
+
+func (s *smp) touch() {
+	if s.inProgress() {
+		s.lastActivity = time.Now()
+	}
+}
+
+// inProgress returns true while we are waiting for the peer to answer. Waiting for the local user to provide the
+// secret doesn't count, since the user might take a while to type the answer.
+func (s *smp) inProgress() bool {
+	switch s.state.(type) {
+	case nil, smpStateExpect1, smpStateWaitingForSecret:
+		return false
+	}
+	return true
+}
+
+func (c *Conversation) smpHasTimedOut(now time.Time) bool {
+	return c.smpTimeout > 0 && c.smp.inProgress() && now.Sub(c.smp.lastActivity) > c.smpTimeout
+}
+
+// CheckSMPTimeout should be called regularly by the host, for example from a timer, while an authentication is in progress.
+// If the peer hasn't answered within the SMP timeout, the authentication is aborted, the event handler is notified with
+// SMPEventTimeout, and the returned messages contain an SMP abort message to send. The host passes the current time from its own clock.
+func (c *Conversation) CheckSMPTimeout(now time.Time) ([]ValidMessage, error) {
+	if c.smp.job != nil || !c.smpHasTimedOut(now) {
+		return nil, nil
+	}
+
+	t := c.restartSMP()
+	c.smp.wipe()
+	c.smp.ensureSMP()
+	c.smpEvent(SMPEventTimeout, 0)
+
+	if !c.IsEncrypted() {
+		return nil, nil
+	}
+
+	msgs, _, err := c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, []tlv{t})
+	return msgs, err
+}
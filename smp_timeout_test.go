@@ -0,0 +1,111 @@
+package otr3
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_CheckSMPTimeout_doesNothingWhenNoTimeoutIsSet(t *testing.T) {
+	alice, _ := conversationsAfterAKE(t)
+	_, err := alice.StartAuthenticate("", []byte("secret"))
+	assertNil(t, err)
+
+	msgs, err := alice.CheckSMPTimeout(time.Now().Add(24 * time.Hour))
+	assertNil(t, err)
+	assertNil(t, msgs)
+	assertEquals(t, alice.smp.state, smpStateExpect2{})
+}
+
+func Test_CheckSMPTimeout_doesNothingBeforeTheTimeoutExpires(t *testing.T) {
+	alice, _ := conversationsAfterAKE(t)
+	alice.SetSMPTimeout(time.Minute)
+	_, err := alice.StartAuthenticate("", []byte("secret"))
+	assertNil(t, err)
+
+	msgs, err := alice.CheckSMPTimeout(time.Now())
+	assertNil(t, err)
+	assertNil(t, msgs)
+	assertEquals(t, alice.smp.state, smpStateExpect2{})
+}
+
+func Test_CheckSMPTimeout_doesNothingWhenNoAuthenticationIsInProgress(t *testing.T) {
+	alice, _ := conversationsAfterAKE(t)
+	alice.SetSMPTimeout(time.Minute)
+
+	msgs, err := alice.CheckSMPTimeout(time.Now())
+	assertNil(t, err)
+	assertNil(t, msgs)
+}
+
+func Test_CheckSMPTimeout_abortsAnAuthenticationThePeerNeverAnswered(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	alice.SetSMPTimeout(time.Minute)
+
+	var events []SMPEvent
+	alice.smpEventHandler = dynamicSMPEventHandler{func(e SMPEvent, _ int, _ string) {
+		events = append(events, e)
+	}}
+	var bobEvents []SMPEvent
+	bob.smpEventHandler = dynamicSMPEventHandler{func(e SMPEvent, _ int, _ string) {
+		bobEvents = append(bobEvents, e)
+	}}
+
+	_, err := alice.StartAuthenticate("", []byte("secret"))
+	assertNil(t, err)
+
+	msgs, err := alice.CheckSMPTimeout(time.Now().Add(2 * time.Minute))
+	assertNil(t, err)
+	assertEquals(t, len(msgs), 1)
+	assertEquals(t, alice.smp.state, smpStateExpect1{})
+	assertNil(t, alice.smp.s1)
+	assertDeepEquals(t, events, []SMPEvent{SMPEventTimeout})
+
+	_, _, err = bob.Receive(msgs[0])
+	assertNil(t, err)
+	assertDeepEquals(t, bobEvents, []SMPEvent{SMPEventAbort})
+}
+
+func Test_CheckSMPTimeout_doesNotAbortWhileWaitingForTheLocalSecret(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	bob.SetSMPTimeout(time.Minute)
+
+	toSend, err := alice.StartAuthenticate("", []byte("secret"))
+	assertNil(t, err)
+	_, _, err = bob.Receive(toSend[0])
+	assertNil(t, err)
+	assertEquals(t, bob.smp.state.identity(), smpStateWaitingForSecret{}.identity())
+
+	msgs, err := bob.CheckSMPTimeout(time.Now().Add(2 * time.Minute))
+	assertNil(t, err)
+	assertNil(t, msgs)
+	assertEquals(t, bob.smp.state.identity(), smpStateWaitingForSecret{}.identity())
+}
+
+func Test_CheckSMPTimeout_canStartANewAuthenticationAfterwards(t *testing.T) {
+	alice, _ := conversationsAfterAKE(t)
+	alice.SetSMPTimeout(time.Minute)
+
+	_, err := alice.StartAuthenticate("", []byte("secret"))
+	assertNil(t, err)
+	_, err = alice.CheckSMPTimeout(time.Now().Add(2 * time.Minute))
+	assertNil(t, err)
+
+	msgs, err := alice.StartAuthenticate("", []byte("secret"))
+	assertNil(t, err)
+	assertEquals(t, len(msgs), 1)
+	assertEquals(t, alice.smp.state, smpStateExpect2{})
+	assertEquals(t, alice.smpHasTimedOut(time.Now()), false)
+}
+
+func Test_CheckSMPTimeout_onlyResetsTheStateWhenNotEncrypted(t *testing.T) {
+	alice, _ := conversationsAfterAKE(t)
+	alice.SetSMPTimeout(time.Minute)
+	_, err := alice.StartAuthenticate("", []byte("secret"))
+	assertNil(t, err)
+	alice.msgState = finished
+
+	msgs, err := alice.CheckSMPTimeout(time.Now().Add(2 * time.Minute))
+	assertNil(t, err)
+	assertNil(t, msgs)
+	assertEquals(t, alice.smp.state, smpStateExpect1{})
+}
@@ -14,11 +14,12 @@ const (
 	tlvTypeSMPAbort          = uint16(0x06)
 	tlvTypeSMP1WithQuestion  = uint16(0x07)
 	tlvTypeExtraSymmetricKey = uint16(0x08)
+	tlvTypeKeyRotation       = uint16(0x09)
 )
 
 type tlvHandler func(*Conversation, tlv, dataMessageExtra) (*tlv, error)
 
-var tlvHandlers = make([]tlvHandler, 9)
+var tlvHandlers = make([]tlvHandler, 10)
 
 func initTLVHandlers() {
 	tlvHandlers[tlvTypePadding] = func(c *Conversation, t tlv, x dataMessageExtra) (*tlv, error) {
@@ -48,6 +49,9 @@ func initTLVHandlers() {
 	tlvHandlers[tlvTypeExtraSymmetricKey] = func(c *Conversation, t tlv, x dataMessageExtra) (*tlv, error) {
 		return c.processExtraSymmetricKeyTLV(t, x)
 	}
+	tlvHandlers[tlvTypeKeyRotation] = func(c *Conversation, t tlv, x dataMessageExtra) (*tlv, error) {
+		return c.processKeyRotationTLV(t, x)
+	}
 }
 
 func messageHandlerForTLV(t tlv) (tlvHandler, error) {
@@ -0,0 +1,323 @@
+package otr3
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/coyim/otr3/sexp"
+)
+
+// VerificationRecord describes a successful SMP authentication. It records which pair of long-term keys
+// was verified, during which session and how, so that the verification can be remembered for later sessions.
+type VerificationRecord struct {
+	OurFingerprint   []byte
+	TheirFingerprint []byte
+	SSID             [8]byte
+	Question         string
+	Time             time.Time
+	WeInitiated      bool
+}
+
+// TrustStore remembers verification records. When the AKE finishes, the conversation will look up the
+// fingerprints of the two keys used, and report the peer as verified if a record is found.
+// StoreVerification is called every time an SMP authentication succeeds.
+type TrustStore interface {
+	StoreVerification(r VerificationRecord)
+	LookupVerification(ourFingerprint, theirFingerprint []byte) (VerificationRecord, bool)
+}
+
+// SetTrustStore sets the trust store where successful authentications are recorded
+func (c *Conversation) SetTrustStore(ts TrustStore) {
+	c.trustStore = ts
+}
+
+// IsVerified returns true if the long-term key of the peer in the current session has been verified using SMP,
+// either in this session or in an earlier one remembered by the trust store
+func (c *Conversation) IsVerified() bool {
+	_, ok := c.Verification()
+	return ok
+}
+
+// Verification returns the record of the SMP authentication that verified the current peer, if there is one.
+// It waits for an SMP computation running in the background to finish first.
+func (c *Conversation) Verification() (VerificationRecord, bool) {
+	c.waitForSMP()
+	if c.verification == nil {
+		return VerificationRecord{}, false
+	}
+	return *c.verification, true
+}
+
+func (c *Conversation) currentFingerprints() (ours, theirs []byte, ok bool) {
+	if c.ourCurrentKey == nil || isNilPublicKey(c.theirKey) {
+		return nil, nil, false
+	}
+	return c.ourCurrentKey.PublicKey().Fingerprint(), c.theirKey.Fingerprint(), true
+}
+
+// lookupVerification is called when a new session starts, to find out whether the peer has been verified before
+func (c *Conversation) lookupVerification() bool {
+	c.verification = nil
+	ours, theirs, ok := c.currentFingerprints()
+	if !ok || c.trustStore == nil {
+		return false
+	}
+
+	if r, found := c.trustStore.LookupVerification(ours, theirs); found {
+		c.verification = &r
+	}
+	return c.verification != nil
+}
+
+// smpVerified is called when an SMP authentication succeeds, before the UI is notified
+func (c *Conversation) smpVerified(weInitiated bool) {
+	ours, theirs, ok := c.currentFingerprints()
+	if !ok {
+		return
+	}
+
+	r := VerificationRecord{
+		OurFingerprint:   ours,
+		TheirFingerprint: theirs,
+		SSID:             c.ssid,
+		Time:             time.Now(),
+		WeInitiated:      weInitiated,
+	}
+
+	if weInitiated && c.smp.s1 != nil && c.smp.s1.msg.hasQuestion {
+		r.Question = c.smp.s1.msg.question
+	} else if !weInitiated && c.smp.question != nil {
+		r.Question = *c.smp.question
+	}
+
+	c.verification = &r
+	if c.trustStore != nil {
+		c.trustStore.StoreVerification(r)
+	}
+}
+
+// MemoryTrustStore is a TrustStore that keeps the latest verification record for every pair of fingerprints in memory.
+// It can be written to and read from the same S-Expression format as the key files.
+type MemoryTrustStore struct {
+	lock    sync.RWMutex
+	records []VerificationRecord
+}
+
+// NewMemoryTrustStore returns an empty trust store
+func NewMemoryTrustStore() *MemoryTrustStore {
+	return &MemoryTrustStore{}
+}
+
+// StoreVerification remembers the record, replacing any earlier record for the same fingerprints
+func (s *MemoryTrustStore) StoreVerification(r VerificationRecord) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, old := range s.records {
+		if old.matches(r.OurFingerprint, r.TheirFingerprint) {
+			s.records[i] = r
+			return
+		}
+	}
+	s.records = append(s.records, r)
+}
+
+// LookupVerification returns the record for the given fingerprints, if there is one
+func (s *MemoryTrustStore) LookupVerification(ourFingerprint, theirFingerprint []byte) (VerificationRecord, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, r := range s.records {
+		if r.matches(ourFingerprint, theirFingerprint) {
+			return r, true
+		}
+	}
+	return VerificationRecord{}, false
+}
+
+// Records returns all the verification records in the trust store
+func (s *MemoryTrustStore) Records() []VerificationRecord {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	ret := make([]VerificationRecord, len(s.records))
+	copy(ret, s.records)
+	return ret
+}
+
+func (r VerificationRecord) matches(ourFingerprint, theirFingerprint []byte) bool {
+	return bytes.Equal(r.OurFingerprint, ourFingerprint) && bytes.Equal(r.TheirFingerprint, theirFingerprint)
+}
+
+const trustStoreForm = "verifications"
+
+type trustStoreFile struct {
+	Records []trustStoreFileRecord `sexp:"verification"`
+}
+
+type trustStoreFileRecord struct {
+	OurFingerprint   string   `sexp:"our-fingerprint"`
+	TheirFingerprint string   `sexp:"their-fingerprint"`
+	SSID             string   `sexp:"ssid"`
+	Question         string   `sexp:"question,omitempty"`
+	Time             *big.Int `sexp:"time"`
+	Initiator        string   `sexp:"initiator,symbol"`
+}
+
+func yesOrNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
+
+func (f trustStoreFileRecord) record() (VerificationRecord, error) {
+	ours, err1 := hex.DecodeString(f.OurFingerprint)
+	theirs, err2 := hex.DecodeString(f.TheirFingerprint)
+	ssid, err3 := hex.DecodeString(f.SSID)
+	if firstError(err1, err2, err3) != nil || len(ours) != fingerprintLength || len(theirs) != fingerprintLength || len(ssid) != 8 {
+		return VerificationRecord{}, errors.New("invalid fingerprint or ssid")
+	}
+	if f.Time == nil || !f.Time.IsInt64() {
+		return VerificationRecord{}, errors.New("invalid time")
+	}
+	if f.Initiator != "yes" && f.Initiator != "no" {
+		return VerificationRecord{}, errors.New("initiator has to be yes or no")
+	}
+
+	r := VerificationRecord{
+		OurFingerprint:   ours,
+		TheirFingerprint: theirs,
+		Question:         f.Question,
+		Time:             time.Unix(f.Time.Int64(), 0),
+		WeInitiated:      f.Initiator == "yes",
+	}
+	copy(r.SSID[:], ssid)
+	return r, nil
+}
+
+// Export writes all the verification records to the writer
+func (s *MemoryTrustStore) Export(w io.Writer) error {
+	var f trustStoreFile
+	for _, r := range s.Records() {
+		f.Records = append(f.Records, trustStoreFileRecord{
+			OurFingerprint:   hex.EncodeToString(r.OurFingerprint),
+			TheirFingerprint: hex.EncodeToString(r.TheirFingerprint),
+			SSID:             hex.EncodeToString(r.SSID[:]),
+			Question:         r.Question,
+			Time:             big.NewInt(r.Time.Unix()),
+			Initiator:        yesOrNo(r.WeInitiated),
+		})
+	}
+
+	v, err := sexp.MarshalForm(trustStoreForm, f)
+	if err != nil {
+		return err
+	}
+	return sexp.Encode(w, v)
+}
+
+// ImportTrustStore reads verification records written by Export into a new trust store
+func ImportTrustStore(r io.Reader) (*MemoryTrustStore, error) {
+	v, err := sexp.Parse(r)
+	if err != nil {
+		return nil, newOtrErrorf("couldn't import trust store: %v", err)
+	}
+
+	var f trustStoreFile
+	if err := sexp.UnmarshalForm(v, trustStoreForm, &f); err != nil {
+		return nil, newOtrErrorf("couldn't import trust store: %v", err)
+	}
+
+	s := NewMemoryTrustStore()
+	for i, fr := range f.Records {
+		r, err := fr.record()
+		if err != nil {
+			return nil, newOtrErrorf("couldn't import verification %d: %v", i+1, err)
+		}
+		s.records = append(s.records, r)
+	}
+	return s, nil
+}
+
+// FileTrustStore is a MemoryTrustStore that writes all its records to a file every time a new record is stored
+type FileTrustStore struct {
+	*MemoryTrustStore
+
+	fname     string
+	saveLock  sync.Mutex
+	lastError error
+}
+
+// OpenFileTrustStore reads the trust store in the named file. If the file doesn't exist yet, the trust store starts out empty,
+// and the file will be created when the first record is stored.
+func OpenFileTrustStore(fname string) (*FileTrustStore, error) {
+	s := &FileTrustStore{MemoryTrustStore: NewMemoryTrustStore(), fname: fname}
+
+	f, err := os.Open(filepath.Clean(fname))
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	s.MemoryTrustStore, err = ImportTrustStore(f)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// StoreVerification remembers the record and writes the trust store to its file.
+// Since this happens in the middle of an authentication, errors writing the file are kept and can be checked with Err.
+func (s *FileTrustStore) StoreVerification(r VerificationRecord) {
+	s.MemoryTrustStore.StoreVerification(r)
+	_ = s.Save()
+}
+
+// Save writes the trust store to its file. The records are written to a temporary file next to it first,
+// which then replaces the file, so the file is left untouched if anything fails.
+func (s *FileTrustStore) Save() error {
+	s.saveLock.Lock()
+	defer s.saveLock.Unlock()
+
+	s.lastError = s.save()
+	return s.lastError
+}
+
+func (s *FileTrustStore) save() error {
+	tmp := s.fname + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Export(f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, s.fname)
+}
+
+// Err returns the error from the last time the trust store was written to its file, if any
+func (s *FileTrustStore) Err() error {
+	s.saveLock.Lock()
+	defer s.saveLock.Unlock()
+	return s.lastError
+}
@@ -0,0 +1,214 @@
+package otr3
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func deliverAll(t *testing.T, to *Conversation, msgs []ValidMessage) []ValidMessage {
+	var toSend []ValidMessage
+	for _, m := range msgs {
+		_, res, err := to.Receive(m)
+		assertNil(t, err)
+		toSend = append(toSend, res...)
+	}
+	return toSend
+}
+
+func completeSMP(t *testing.T, initiator, responder *Conversation, question string, initiatorSecret, responderSecret []byte) {
+	toSend, err := initiator.StartAuthenticate(question, initiatorSecret)
+	assertNil(t, err)
+	assertEquals(t, len(deliverAll(t, responder, toSend)), 0)
+
+	toSend, err = responder.ProvideAuthenticationSecret(responderSecret)
+	assertNil(t, err)
+	toSend = deliverAll(t, initiator, toSend)
+	toSend = deliverAll(t, responder, toSend)
+	deliverAll(t, initiator, toSend)
+}
+
+func Test_SMPSuccess_producesAVerificationRecordOnBothSides(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	before := time.Now()
+
+	completeSMP(t, alice, bob, "what's our secret?", []byte("secret"), []byte("secret"))
+
+	ra, ok := alice.Verification()
+	assertEquals(t, ok, true)
+	assertDeepEquals(t, ra.OurFingerprint, alicePrivateKey.PublicKey().Fingerprint())
+	assertDeepEquals(t, ra.TheirFingerprint, bobPrivateKey.PublicKey().Fingerprint())
+	assertEquals(t, ra.SSID, alice.ssid)
+	assertEquals(t, ra.Question, "what's our secret?")
+	assertEquals(t, ra.WeInitiated, true)
+	assertEquals(t, ra.Time.Before(before), false)
+
+	rb, ok := bob.Verification()
+	assertEquals(t, ok, true)
+	assertDeepEquals(t, rb.OurFingerprint, bobPrivateKey.PublicKey().Fingerprint())
+	assertDeepEquals(t, rb.TheirFingerprint, alicePrivateKey.PublicKey().Fingerprint())
+	assertEquals(t, rb.SSID, alice.ssid)
+	assertEquals(t, rb.Question, "what's our secret?")
+	assertEquals(t, rb.WeInitiated, false)
+}
+
+func Test_SMPFailure_doesNotProduceAVerificationRecord(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	store := NewMemoryTrustStore()
+	alice.SetTrustStore(store)
+
+	completeSMP(t, alice, bob, "", []byte("secret"), []byte("something else"))
+
+	assertEquals(t, alice.IsVerified(), false)
+	assertEquals(t, bob.IsVerified(), false)
+	assertEquals(t, len(store.Records()), 0)
+}
+
+func Test_End_forgetsTheVerification(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	completeSMP(t, alice, bob, "", []byte("secret"), []byte("secret"))
+
+	toSend, err := alice.End()
+	assertNil(t, err)
+	assertEquals(t, alice.IsVerified(), false)
+
+	deliverAll(t, bob, toSend)
+	assertEquals(t, bob.IsVerified(), false)
+}
+
+func Test_SMPSuccess_isReportedToTheTrustStoreAndConsultedInTheNextSession(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	store := NewMemoryTrustStore()
+	alice.SetTrustStore(store)
+
+	completeSMP(t, alice, bob, "", []byte("secret"), []byte("secret"))
+	assertEquals(t, len(store.Records()), 1)
+
+	alice2 := &Conversation{Rand: rand.Reader}
+	alice2.SetOurKeys([]PrivateKey{alicePrivateKey})
+	alice2.Policies = policies(allowV3)
+	alice2.SetTrustStore(store)
+	var events []SecurityEvent
+	alice2.SetSecurityEventHandler(dynamicSecurityEventHandler{func(e SecurityEvent) {
+		events = append(events, e)
+	}})
+
+	bob2 := &Conversation{Rand: rand.Reader}
+	bob2.SetOurKeys([]PrivateKey{bobPrivateKey})
+	bob2.Policies = policies(allowV3)
+
+	completeAKE(t, alice2, bob2)
+
+	assertDeepEquals(t, events, []SecurityEvent{GoneSecure, PeerVerified})
+	assertEquals(t, alice2.IsVerified(), true)
+	assertEquals(t, bob2.IsVerified(), false)
+
+	r, _ := alice2.Verification()
+	assertEquals(t, r.SSID, alice.ssid)
+}
+
+func Test_TrustStore_isNotConsultedForADifferentPeerKey(t *testing.T) {
+	store := NewMemoryTrustStore()
+	store.StoreVerification(VerificationRecord{
+		OurFingerprint:   alicePrivateKey.PublicKey().Fingerprint(),
+		TheirFingerprint: alicePrivateKey.PublicKey().Fingerprint(),
+	})
+
+	alice := &Conversation{Rand: rand.Reader}
+	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
+	alice.Policies = policies(allowV3)
+	alice.SetTrustStore(store)
+	bob := &Conversation{Rand: rand.Reader}
+	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
+	bob.Policies = policies(allowV3)
+
+	completeAKE(t, alice, bob)
+	assertEquals(t, alice.IsVerified(), false)
+}
+
+func fixtureVerificationRecord() VerificationRecord {
+	return VerificationRecord{
+		OurFingerprint:   alicePrivateKey.PublicKey().Fingerprint(),
+		TheirFingerprint: bobPrivateKey.PublicKey().Fingerprint(),
+		SSID:             [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+		Question:         "where did we meet?",
+		Time:             time.Unix(1700000000, 0),
+		WeInitiated:      true,
+	}
+}
+
+func Test_MemoryTrustStore_replacesTheRecordForTheSameFingerprints(t *testing.T) {
+	store := NewMemoryTrustStore()
+	r := fixtureVerificationRecord()
+	store.StoreVerification(r)
+	r.Question = "something else"
+	store.StoreVerification(r)
+
+	assertEquals(t, len(store.Records()), 1)
+	res, ok := store.LookupVerification(r.OurFingerprint, r.TheirFingerprint)
+	assertEquals(t, ok, true)
+	assertEquals(t, res.Question, "something else")
+
+	_, ok = store.LookupVerification(r.TheirFingerprint, r.OurFingerprint)
+	assertEquals(t, ok, false)
+}
+
+func Test_MemoryTrustStore_canBeExportedAndImported(t *testing.T) {
+	store := NewMemoryTrustStore()
+	r1 := fixtureVerificationRecord()
+	r2 := fixtureVerificationRecord()
+	r2.TheirFingerprint = alicePrivateKey.PublicKey().Fingerprint()
+	r2.Question = ""
+	r2.WeInitiated = false
+	store.StoreVerification(r1)
+	store.StoreVerification(r2)
+
+	var b bytes.Buffer
+	assertNil(t, store.Export(&b))
+
+	res, err := ImportTrustStore(&b)
+	assertNil(t, err)
+	records := res.Records()
+	assertEquals(t, len(records), 2)
+	assertDeepEquals(t, records[0], r1)
+	assertDeepEquals(t, records[1], r2)
+}
+
+func Test_ImportTrustStore_returnsAnErrorForInvalidRecords(t *testing.T) {
+	_, err := ImportTrustStore(bytes.NewBufferString(`(verifications (verification (our-fingerprint "00") (their-fingerprint "00") (ssid "0102030405060708") (time #01#) (initiator yes)))`))
+	assertEquals(t, err, newOtrError("couldn't import verification 1: invalid fingerprint or ssid"))
+
+	_, err = ImportTrustStore(bytes.NewBufferString(`(privkeys)`))
+	assertEquals(t, err, newOtrError("couldn't import trust store: sexp: expected form verifications"))
+}
+
+func Test_FileTrustStore_persistsRecordsAcrossOpens(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "trust")
+
+	store, err := OpenFileTrustStore(fname)
+	assertNil(t, err)
+	assertEquals(t, len(store.Records()), 0)
+
+	store.StoreVerification(fixtureVerificationRecord())
+	assertNil(t, store.Err())
+
+	store2, err := OpenFileTrustStore(fname)
+	assertNil(t, err)
+	r, ok := store2.LookupVerification(alicePrivateKey.PublicKey().Fingerprint(), bobPrivateKey.PublicKey().Fingerprint())
+	assertEquals(t, ok, true)
+	assertDeepEquals(t, r, fixtureVerificationRecord())
+}
+
+func Test_FileTrustStore_keepsTheErrorWhenTheFileCantBeWritten(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "missing", "trust")
+
+	store, err := OpenFileTrustStore(fname)
+	assertNil(t, err)
+	store.StoreVerification(fixtureVerificationRecord())
+
+	assertEquals(t, os.IsNotExist(store.Err()), true)
+	assertEquals(t, len(store.Records()), 1)
+}
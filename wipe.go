@@ -48,6 +48,8 @@ func (a *ake) wipe(wipeKeys bool) {
 	wipeBigInt(a.theirPublicValue)
 	a.theirPublicValue = nil
 
+	a.previousTheirKey = nil
+
 	wipeBytes(a.r[:])
 
 	a.wipeGX()
@@ -180,6 +182,10 @@ func zeroesUint32(n int) []uint32 {
 	return make([]uint32, n)
 }
 
+func zeroesUint64(n int) []uint64 {
+	return make([]uint64, n)
+}
+
 func zeroesInt8(n int) []int8 {
 	return make([]int8, n)
 }
@@ -204,6 +210,12 @@ func wipeUint32(b []uint32) {
 	runtime.KeepAlive(b)
 }
 
+func wipeUint64(b []uint64) {
+	copy(b, zeroesUint64(len(b)))
+
+	runtime.KeepAlive(b)
+}
+
 func wipeInt8(b []int8) {
 	copy(b, zeroesInt8(len(b)))
 
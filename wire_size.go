@@ -0,0 +1,78 @@
+package otr3
+
+// WireSize describes how a message will look on the wire once Send has encrypted and fragmented it
+type WireSize struct {
+	// EncodedSize is the size in bytes of the encoded message, before it is fragmented
+	EncodedSize int
+	// TotalSize is the sum of the sizes of all the messages that will be sent, including the fragment headers
+	TotalSize int
+	// Fragments is the number of messages that will be sent
+	Fragments int
+}
+
+func wireSizeOf(encodedSize int, msgs []ValidMessage) WireSize {
+	res := WireSize{EncodedSize: encodedSize, Fragments: len(msgs)}
+	for _, m := range msgs {
+		res.TotalSize += len(m)
+	}
+	return res
+}
+
+// EstimateWireSize returns the exact size the message would have on the wire if it was given to Send right now,
+// and how many fragments it would be split into. Contrary to Send, it doesn't use up a counter, change any keys or
+// notify any handlers, so it can be called for every change to the message the user is writing.
+// Heartbeat messages and messages queued for injection, that Send might return as well, are not included.
+// With PaddingRandom, the size is for the most padding the message could get.
+func (c *Conversation) EstimateWireSize(m ValidMessage) (WireSize, error) {
+	if !c.Policies.isOTREnabled() {
+		return WireSize{len(m), len(m), 1}, nil
+	}
+
+	switch c.msgState {
+	case plainText:
+		return c.estimatePlaintextWireSize(m), nil
+	case encrypted:
+		return c.estimateEncryptedWireSize(m)
+	case finished:
+		return WireSize{}, newOtrError("cannot send message because secure conversation has finished")
+	}
+	return WireSize{}, newOtrError("cannot send message in current state")
+}
+
+func (c *Conversation) estimatePlaintextWireSize(m ValidMessage) WireSize {
+	if c.Policies.has(requireEncryption) {
+		l := len(c.QueryMessage())
+		return WireSize{l, l, 1}
+	}
+
+	l := len(m)
+	if c.Policies.has(sendWhitespaceTag) && c.whitespaceState != whitespaceRejected {
+		l += len(genWhitespaceTag(c.Policies))
+	}
+	return WireSize{l, l, 1}
+}
+
+func (c *Conversation) estimateEncryptedWireSize(m ValidMessage) (WireSize, error) {
+	// Without a source of randomness, the largest random padding is used
+	plain, _ := c.padPlaintext(plainDataMsg{message: c.convertMessage(ConvertSending, m)}, nil)
+
+	// The encrypted message and the authenticator only need to have the right length,
+	// so the data message is never encrypted or signed, and no keys are used
+	dataMessage := dataMsg{
+		flag:           messageFlagNormal,
+		senderKeyID:    c.keys.ourKeyID - 1,
+		recipientKeyID: c.keys.theirKeyID,
+		y:              c.keys.ourCurrentDHKeys.pub,
+		encryptedMsg:   make([]byte, len(plain.serialize())),
+		authenticator:  make([]byte, c.version.hashLength()),
+		oldMACKeys:     c.keys.oldMACKeys,
+	}
+
+	res, err := c.wrapMessageHeader(msgTypeData, dataMessage.serialize(c.version))
+	if err != nil {
+		return WireSize{}, err
+	}
+
+	encoded := c.encode(res)
+	return wireSizeOf(len(encoded), c.fragment(encoded, c.currentFragmentSize())), nil
+}
@@ -0,0 +1,116 @@
+package otr3
+
+import (
+	"strings"
+	"testing"
+)
+
+func assertWireSizeMatches(t *testing.T, c *Conversation, m string) {
+	estimate, err := c.EstimateWireSize(ValidMessage(m))
+	assertNil(t, err)
+
+	msgs, err := c.Send(ValidMessage(m))
+	assertNil(t, err)
+	assertDeepEquals(t, estimate, wireSizeOf(estimate.EncodedSize, msgs))
+	if len(msgs) == 1 {
+		assertEquals(t, estimate.EncodedSize, len(msgs[0]))
+	}
+}
+
+func Test_EstimateWireSize_returnsTheSizeOfTheEncryptedMessage(t *testing.T) {
+	alice, _ := conversationsAfterAKE(t)
+
+	for _, m := range []string{"", "hi", strings.Repeat("a", 250), strings.Repeat("b", 251), strings.Repeat("c", 1000)} {
+		assertWireSizeMatches(t, alice, m)
+	}
+}
+
+func Test_EstimateWireSize_countsTheFragments(t *testing.T) {
+	alice, _ := conversationsAfterAKE(t)
+	alice.SetFragmentSize(150)
+
+	estimate, err := alice.EstimateWireSize(ValidMessage(strings.Repeat("hello ", 100)))
+	assertNil(t, err)
+	assertEquals(t, estimate.Fragments > 5, true)
+	assertEquals(t, estimate.TotalSize > estimate.EncodedSize, true)
+
+	for _, m := range []string{"hi", strings.Repeat("hello ", 100)} {
+		assertWireSizeMatches(t, alice, m)
+	}
+}
+
+func Test_EstimateWireSize_includesTheMACKeysThatWillBeRevealed(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+
+	for i := 0; i < 3; i++ {
+		msgs, _ := alice.Send(ValidMessage("ping"))
+		receiveAll(t, bob, msgs...)
+		msgs, _ = bob.Send(ValidMessage("pong"))
+		receiveAll(t, alice, msgs...)
+	}
+	assertEquals(t, len(alice.keys.oldMACKeys) > 0, true)
+
+	assertWireSizeMatches(t, alice, "hello")
+	assertEquals(t, len(alice.keys.oldMACKeys), 0)
+}
+
+func Test_EstimateWireSize_doesNotChangeTheConversation(t *testing.T) {
+	alice, bob := conversationsAfterAKE(t)
+	alice.SetFragmentSize(150)
+	msgs, _ := bob.Send(ValidMessage("hello"))
+	receiveAll(t, alice, msgs...)
+	var events []MessageEvent
+	alice.SetMessageEventHandler(dynamicMessageEventHandler{func(e MessageEvent, _ []byte, _ error, _ ...interface{}) {
+		events = append(events, e)
+	}})
+	oldMACKeys := len(alice.keys.oldMACKeys)
+	counter := alice.keys.counterHistory.findCounterFor(alice.keys.ourKeyID-1, alice.keys.theirKeyID).ourCounter
+
+	one, _ := alice.EstimateWireSize(ValidMessage("hello there"))
+	two, _ := alice.EstimateWireSize(ValidMessage("hello there"))
+
+	assertDeepEquals(t, one, two)
+	assertEquals(t, len(alice.keys.oldMACKeys), oldMACKeys)
+	assertEquals(t, alice.keys.counterHistory.findCounterFor(alice.keys.ourKeyID-1, alice.keys.theirKeyID).ourCounter, counter)
+	assertEquals(t, len(events), 0)
+
+	msgs, _ = alice.Send(ValidMessage("hello there"))
+	assertEquals(t, string(receiveAll(t, bob, msgs...)), "hello there")
+}
+
+func Test_EstimateWireSize_returnsThePlainMessageSizeWhenNotEncrypted(t *testing.T) {
+	c := &Conversation{}
+	c.Policies = policies(allowV3)
+	res, err := c.EstimateWireSize(ValidMessage("hello"))
+	assertNil(t, err)
+	assertEquals(t, res, WireSize{5, 5, 1})
+
+	c.Policies.add(sendWhitespaceTag)
+	res, _ = c.EstimateWireSize(ValidMessage("hello"))
+	assertEquals(t, res.EncodedSize, 5+len(genWhitespaceTag(c.Policies)))
+
+	c.Policies.add(requireEncryption)
+	res, _ = c.EstimateWireSize(ValidMessage("hello"))
+	assertEquals(t, res.EncodedSize, len(c.QueryMessage()))
+}
+
+func Test_EstimateWireSize_returnsAnErrorWhenTheConversationIsFinished(t *testing.T) {
+	c := &Conversation{msgState: finished}
+	c.Policies = policies(allowV3)
+	_, err := c.EstimateWireSize(ValidMessage("hello"))
+	assertEquals(t, err, newOtrError("cannot send message because secure conversation has finished"))
+}
+
+func Test_EstimateWireSize_includesTheChangesOfTheMessageConverter(t *testing.T) {
+	alice, _ := conversationsAfterAKE(t)
+	alice.SetMessageConverter(dynamicMessageConverter{func(_ ConvertType, msg []byte) []byte {
+		return []byte(strings.Repeat(string(msg), 100))
+	}})
+
+	withoutConverter, _ := conversationsAfterAKE(t)
+	plain, _ := withoutConverter.EstimateWireSize(ValidMessage("hello"))
+	converted, _ := alice.EstimateWireSize(ValidMessage("hello"))
+	assertEquals(t, converted.EncodedSize > plain.EncodedSize, true)
+
+	assertWireSizeMatches(t, alice, "hello")
+}